@@ -1,68 +1,44 @@
 package calibre
 
 import (
-	"bytes"
 	"fmt"
 	"math"
 	"math/rand"
-	"mime/multipart"
+	"net/url"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
-)
-
-type Format uint8
-
-func (f Format) Ext() string {
-	switch f {
-	case FormatPDF:
-		return "pdf"
-	case FormatEPUB:
-		return "epub"
-	case FormatMOBI:
-		return "mobi"
-	case FormatAZW3:
-		return "azw3"
-	case FormatDOCX:
-		return "docx"
-	case FormatRTF:
-		return "rtf"
-	case FormatFB2:
-		return "fb2"
-	case FormatLIT:
-		return "lit"
-	case FormatLRF:
-		return "lrf"
-	case FormatTXT:
-		return "txt"
-	case FormatHTMLZ:
-		return "htmlz"
-	case FormatODT:
-		return "odt"
-	case FormatCBZ:
-		return "cbz"
-	default:
-		panic(fmt.Sprintf("unhandled format %d", f))
-	}
-}
 
+	"github.com/yrhki/gocalibre/calibre-web/format"
+	"github.com/yrhki/gocalibre/calibre-web/identifier"
+	"github.com/yrhki/gocalibre/calibre-web/uploadcontent"
+)
 
+type Format = format.Format
 
 const (
-	FormatPDF Format = iota
-	FormatMOBI
-	FormatEPUB
-	FormatAZW3
-	FormatDOCX
-	FormatRTF
-	FormatFB2
-	FormatLIT
-	FormatLRF
-	FormatTXT
-	FormatHTMLZ
-	FormatODT
-	FormatCBZ
+	FormatPDF = format.PDF
+	FormatMOBI = format.MOBI
+	FormatEPUB = format.EPUB
+	FormatAZW3 = format.AZW3
+	FormatDOCX = format.DOCX
+	FormatRTF = format.RTF
+	FormatFB2 = format.FB2
+	FormatLIT = format.LIT
+	FormatLRF = format.LRF
+	FormatTXT = format.TXT
+	FormatHTMLZ = format.HTMLZ
+	FormatODT = format.ODT
+	FormatCBZ = format.CBZ
+	FormatCBR = format.CBR
+	FormatCB7 = format.CB7
 )
 
+var Formats = format.All
+
+// FormatFromExt returns the format for a file extension, with or without a leading dot
+func FormatFromExt(ext string) (Format, bool) { return format.FromExt(ext) }
 
 type ListBook struct {
 	id uint64
@@ -107,6 +83,12 @@ func GetRating(rating uint8) Rating {
 type Book struct {
 	id uint64
 	formats map[Format]bool
+	sizes map[Format]int64
+	acquisitions map[Format]string
+	checksums map[Format][]byte
+	// stored are the identifiers as loaded from the server
+	stored BookIdentifiers
+	read, archived bool
 
 	Title string
 	Series string
@@ -122,55 +104,77 @@ type Book struct {
 }
 
 func (book *Book) ID() uint64 { return book.id }
+func (book *Book) IsRead() bool { return book.read }
+func (book *Book) IsArchived() bool { return book.archived }
 
 func (book *Book) HasFormat(format Format) bool {
 	t, ok := book.formats[format]
 	return ok && t
 }
 
-func (book *Book) multipart() (*multipart.Writer, *bytes.Buffer, error) {
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
-
-	err := w.WriteField("book_title", book.Title)
-	if err != nil { return nil, nil, err }
-	err = w.WriteField("author_name", strings.Join(book.Authors, " & "))
-	if err != nil { return nil, nil, err }
-	err = w.WriteField("description", book.Description)
-	if err != nil { return nil, nil, err }
-	err = w.WriteField("tags", strings.Join(book.Categories, ", "))
-	if err != nil { return nil, nil, err }
-	err = w.WriteField("series", book.Series)
-	if err != nil { return nil, nil, err }
-	err = w.WriteField("series_index", fmt.Sprintf("%v", book.SeriesIndex))
-	if err != nil { return nil, nil, err }
-	err = w.WriteField("rating", fmt.Sprintf("%d", book.Rating))
-	if err != nil { return nil, nil, err }
-	err = w.WriteField("cover_url", "")
-	if err != nil { return nil, nil, err }
+// Size returns the file size of a format as shown on the book page, which is rounded
+func (book *Book) Size(format Format) (int64, bool) {
+	size, ok := book.sizes[format]
+	return size, ok
+}
+
+// Acquisition returns the OPDS download link of a format, it is only
+// known for books loaded from the OPDS catalog
+func (book *Book) Acquisition(format Format) (string, bool) {
+	href, ok := book.acquisitions[format]
+	return href, ok
+}
+
+// Formats returns the formats of the book
+func (book *Book) Formats() []Format {
+	formats := []Format{}
+	for _, format := range Formats {
+		if book.HasFormat(format) { formats = append(formats, format) }
+	}
+	return formats
+}
+
+// Checksum returns the SHA-256 of a format uploaded with this Book value
+func (book *Book) Checksum(format Format) ([]byte, bool) {
+	sum, ok := book.checksums[format]
+	return sum, ok
+}
+
+func (book *Book) setChecksum(c uploadcontent.Content) {
+	format, ok := FormatFromExt(filepath.Ext(c.Filename()))
+	if !ok { return }
+	if book.checksums == nil { book.checksums = make(map[Format][]byte) }
+	book.checksums[format] = c.SHA256()
+}
+
+func (book *Book) multipart() *multipartBody {
+	m := newMultipart()
+
+	m.field("book_title", book.Title)
+	m.field("author_name", strings.Join(book.Authors, " & "))
+	m.field("description", book.Description)
+	m.field("tags", strings.Join(book.Categories, ", "))
+	m.field("series", book.Series)
+	m.field("series_index", fmt.Sprintf("%v", book.SeriesIndex))
+	m.field("rating", fmt.Sprintf("%d", book.Rating))
+	m.field("cover_url", "")
 
 	if book.Published != nil {
-		err = w.WriteField("pubdate", book.Published.Format("2006-01-02"))
-		if err != nil { return nil, nil, err }
+		m.field("pubdate", book.Published.Format("2006-01-02"))
 	} else {
-		err = w.WriteField("pubdate", "")
-		if err != nil { return nil, nil, err }
+		m.field("pubdate", "")
 	}
 
-	err = w.WriteField("publisher", book.Publisher)
-	if err != nil { return nil, nil, err }
-	err = w.WriteField("languages", strings.Join(book.Languages, ", "))
-	if err != nil { return nil, nil, err }
+	m.field("publisher", book.Publisher)
+	m.field("languages", strings.Join(book.Languages, ", "))
 
 	for t, v := range book.Identifiers {
 		id := uint(math.Floor(rand.Float64() * 1000000))
 
-		err = w.WriteField(fmt.Sprintf("identifier-type-%d", id), t)
-		if err != nil { return nil, nil, err }
-		err = w.WriteField(fmt.Sprintf("identifier-val-%d", id), v)
-		if err != nil { return nil, nil, err }
+		m.field(fmt.Sprintf("identifier-type-%d", id), t)
+		m.field(fmt.Sprintf("identifier-val-%d", id), v)
 	}
-	return w, &b, nil
+	return m
 }
 
 
@@ -197,6 +201,102 @@ func (iden BookIdentifiers) ISFDB() (string, bool) { return iden.hasIdentifier("
 func (iden BookIdentifiers) Lubimyczytac() (string, bool) { return iden.hasIdentifier("lubimyczytac") }
 func (iden BookIdentifiers) URL() (string, bool) { return iden.hasIdentifier("url") }
 
+// InvalidIdentifierError is returned for identifiers that fail validation
+type InvalidIdentifierError struct {
+	Type, Value string
+	Err error
+}
+
+func (e *InvalidIdentifierError) Error() string { return fmt.Sprintf("%s %q: %s", e.Type, e.Value, e.Err) }
+func (e *InvalidIdentifierError) Unwrap() error { return e.Err }
+
+// normalizeIdentifier validates isbn, issn and doi values and returns
+// them in their canonical form, other types are returned unchanged
+func normalizeIdentifier(t, v string) (string, error) {
+	n, err := v, error(nil)
+	switch t {
+	case "isbn":
+		n, err = identifier.NormalizeISBN(v)
+	case "issn":
+		n, err = identifier.NormalizeISSN(v)
+	case "doi":
+		n, err = identifier.NormalizeDOI(v)
+	}
+	if err != nil { return "", &InvalidIdentifierError{Type: t, Value: v, Err: err} }
+	return n, nil
+}
+
+// Validate checks the ISBN, ISSN and DOI and returns the first invalid one
+func (iden BookIdentifiers) Validate() error {
+	_, err := iden.Normalized()
+	return err
+}
 
+// Normalized returns a copy with ISBNs stripped of hyphens, ISSNs as
+// 1234-5678 and DOIs without resolver prefix
+func (iden BookIdentifiers) Normalized() (BookIdentifiers, error) { return iden.normalizedSince(nil) }
 
+// normalizedSince normalizes the identifiers that differ from stored and
+// keeps the others unchanged, so an invalid value already saved on the
+// server does not block unrelated edits
+func (iden BookIdentifiers) normalizedSince(stored BookIdentifiers) (BookIdentifiers, error) {
+	types := make([]string, 0, len(iden))
+	for t := range iden { types = append(types, t) }
+	sort.Strings(types)
 
+	n := make(BookIdentifiers, len(iden))
+	for _, t := range types {
+		if v, ok := stored[t]; ok && v == iden[t] {
+			n[t] = v
+			continue
+		}
+		v, err := normalizeIdentifier(t, iden[t])
+		if err != nil { return nil, err }
+		n[t] = v
+	}
+	return n, nil
+}
+
+// identifierLinks are the paths before the value in the links calibre-web
+// shows for identifiers
+var identifierLinks = map[string]string{
+	"amazon": "/dp/",
+	"asin": "/dp/",
+	"isbn": "/isbn/",
+	"goodreads": "/book/show/",
+	"babelio": "/livres/titre/",
+	"kobo": "/ebook/",
+	"litres": "/",
+	"issn": "/resource/ISSN/",
+	"databazeknih": "/knihy/",
+	"douban": "/subject/",
+}
+
+// identifierFromLink returns the value of an identifier from the link the
+// book page shows for it. Types without link show the value itself.
+func identifierFromLink(t, href string) string {
+	u, err := url.Parse(href)
+	if err != nil || u.Host == "" || t == "url" { return href }
+	// Everything after the host, unescaped as calibre-web inserts the value as is
+	rest := href[strings.Index(href, u.Host) + len(u.Host):]
+
+	prefix, ok := identifierLinks[t]
+	if strings.HasPrefix(t, "amazon_") { prefix, ok = "/dp/", true }
+	switch {
+	case t == "doi":
+		// dx.doi.org/<prefix>/<suffix>
+		return strings.TrimPrefix(rest, "/")
+	case t == "isfdb":
+		// pl.cgi?<id>
+		return u.RawQuery
+	case t == "google":
+		return u.Query().Get("id")
+	case t == "lubimyczytac":
+		// /ksiazka/<id>/ksiazka
+		segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(segments) == 3 { return segments[1] }
+	case ok && strings.HasPrefix(rest, prefix):
+		return rest[len(prefix):]
+	}
+	return href
+}
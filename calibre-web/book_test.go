@@ -0,0 +1,62 @@
+package calibre
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestIdentifierFromLink(t *testing.T) {
+	tests := []struct {
+		t, href, want string
+	}{
+		{"isbn", "https://www.worldcat.org/isbn/9780261102354", "9780261102354"},
+		{"doi", "https://dx.doi.org/10.1000/182", "10.1000/182"},
+		{"doi", "https://dx.doi.org/10.1002/(SICI)1097-4571(199806)49:8", "10.1002/(SICI)1097-4571(199806)49:8"},
+		{"issn", "https://portal.issn.org/resource/ISSN/0378-5955", "0378-5955"},
+		{"amazon", "https://amazon.com/dp/B000FC1PJI", "B000FC1PJI"},
+		{"amazon_de", "https://amazon.de/dp/3608938281", "3608938281"},
+		{"asin", "https://amazon.com/dp/B000FC1PJI", "B000FC1PJI"},
+		{"goodreads", "https://www.goodreads.com/book/show/34", "34"},
+		{"google", "https://books.google.com/books?id=aWZzLPhY4o0C", "aWZzLPhY4o0C"},
+		{"kobo", "https://www.kobo.com/ebook/the-fellowship-of-the-ring", "the-fellowship-of-the-ring"},
+		{"isfdb", "http://www.isfdb.org/cgi-bin/pl.cgi?3016", "3016"},
+		{"lubimyczytac", "https://lubimyczytac.pl/ksiazka/4843/ksiazka", "4843"},
+		{"litres", "https://www.litres.ru/171419", "171419"},
+		{"douban", "https://book.douban.com/subject/1082154", "1082154"},
+		{"databazeknih", "https://www.databazeknih.cz/knihy/pan-prstenu-1", "pan-prstenu-1"},
+		{"babelio", "https://www.babelio.com/livres/titre/6458", "6458"},
+		{"url", "https://example.com/books/1", "https://example.com/books/1"},
+		// Types without link show the value
+		{"custom", "https://example.com/books/1", "https://example.com/books/1"},
+		{"custom", "abc123", "abc123"},
+		{"isbn", "9780261102354", "9780261102354"},
+	}
+	for _, test := range tests {
+		if got := identifierFromLink(test.t, test.href); got != test.want {
+			t.Errorf("identifierFromLink(%q, %q) = %q, want %q", test.t, test.href, got, test.want)
+		}
+	}
+}
+
+func TestNormalizedSince(t *testing.T) {
+	stored := BookIdentifiers{"isbn": "978-0-261-10235-5", "doi": "10.1000/ABC"}
+
+	// Unchanged values are kept, even if invalid
+	iden := BookIdentifiers{"isbn": "978-0-261-10235-5", "doi": "10.1000/ABC", "issn": "03785955"}
+	got, err := iden.normalizedSince(stored)
+	if err != nil { t.Fatal(err) }
+	if want := (BookIdentifiers{"isbn": "978-0-261-10235-5", "doi": "10.1000/ABC", "issn": "0378-5955"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Changed values are validated
+	iden["isbn"] = "978-0-261-10235-6"
+	_, err = iden.normalizedSince(stored)
+	var invalid *InvalidIdentifierError
+	if !errors.As(err, &invalid) || invalid.Type != "isbn" || invalid.Value != "978-0-261-10235-6" { t.Errorf("got error %v, want invalid isbn", err) }
+
+	// Without stored state everything is validated
+	_, err = stored.Normalized()
+	if !errors.As(err, &invalid) { t.Errorf("got error %v, want invalid identifier", err) }
+}
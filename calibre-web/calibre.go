@@ -2,22 +2,26 @@ package calibre
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"mime/multipart"
+	"mime"
 	"net/http"
 	"net/http/cookiejar"
-	"net/textproto"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/yrhki/gocalibre/calibre-web/opds"
+	"github.com/yrhki/gocalibre/calibre-web/progress"
 	"github.com/yrhki/gocalibre/calibre-web/uploadcontent"
 	"github.com/PuerkitoBio/goquery"
 )
@@ -37,8 +41,21 @@ type authorReponse struct {
 type API struct {
 	url string
 	c *http.Client
+	progress progress.Reporter
+	sel *selectors
+	selMu sync.Mutex
+	opds *opds.Client
+	// username is the logged in user, it tells own tasks from those of others
+	username string
+	// genericCover is the cover of books without one, it is kept once loaded
+	genericCover *coverSignature
+	genericMu sync.Mutex
 }
 
+// SetProgress sets where the progress of uploads and downloads is reported,
+// nil disables reporting
+func (api *API) SetProgress(rep progress.Reporter) { api.progress = rep }
+
 func (api *API) Login(username, password string) error {
 	data := url.Values{
 		"next": {"/me"},
@@ -49,7 +66,10 @@ func (api *API) Login(username, password string) error {
 	resp, err := api.c.PostForm(api.url + "/login", data)
 	if err != nil { return err }
 	defer resp.Body.Close()
-	return checkFlashAlert(resp)
+	err = checkFlashAlert(resp)
+	if err != nil { return err }
+	api.username = username
+	return nil
 }
 
 func (api *API) Logout() error {
@@ -124,81 +144,139 @@ func (api *API) GetLanguages() ([]string, error) { return api.getAPI("/get_langu
 func (api *API) GetSeries() ([]string, error) { return api.getAPI("/get_series_json") }
 
 func (api *API) ListBooks() ([]*ListBook, error) {
+	if api.opds != nil { return api.opdsBooks(context.Background(), "new") }
+	return api.listBooks("root")
+}
+
+// listBooks reads all pages of a book listing like root, read or archived
+func (api *API) listBooks(data string) ([]*ListBook, error) {
 
 	books := []*ListBook{}
 
 	for i := 1; ; i++ {
-		resp, err := api.c.Get(fmt.Sprintf("%s/root/old/1/%d", api.url, i))
+		resp, err := api.c.Get(fmt.Sprintf("%s/%s/old/1/%d", api.url, data, i))
 		if err != nil { return nil, err }
 		defer resp.Body.Close()
 
 		doc, err := goquery.NewDocumentFromReader(resp.Body)
 		if err != nil { return nil, err }
 
+		books = append(books, parseBookList(doc)...)
 
-		doc.Find(".book").Each(func(_ int, s *goquery.Selection) {
-			title := s.Find(".title").Text()
-			ids, hasid := s.Find(".meta a").Attr("href")
-			if !hasid { panic("unable to parse book id") }
-			bookID, err := strconv.ParseUint(filepath.Base(ids), 10, 0)
-			if err != nil { panic(err) }
+		if doc.Find(".next").Text() == "" { break }
+	}
+	return books, nil
+}
 
-			authors := []Author{}
+// parseBookList parses the books of a listing page
+func parseBookList(doc *goquery.Document) []*ListBook {
+	books := []*ListBook{}
+	doc.Find(".book").Each(func(_ int, s *goquery.Selection) {
+		title := s.Find(".title").Text()
+		ids, hasid := s.Find(".meta a").Attr("href")
+		if !hasid { panic("unable to parse book id") }
+		bookID, err := strconv.ParseUint(filepath.Base(ids), 10, 0)
+		if err != nil { panic(err) }
 
-			s.Find(".author-name").Each(func(_ int, s *goquery.Selection) {
-				item, err := parseListItem(s)
-				if err != nil { panic(err) }
-				authors = append(authors, Author{id:item.ID(), name:item.Name()})
-			})
+		authors := []Author{}
 
-			books = append(books, &ListBook{id:bookID, name:title, authors:authors})
+		s.Find(".author-name").Each(func(_ int, s *goquery.Selection) {
+			item, err := parseListItem(s)
+			if err != nil { panic(err) }
+			authors = append(authors, Author{id:item.ID(), name:item.Name()})
 		})
 
-		if doc.Find(".next").Text() == "" { break }
-	}
-	return books, nil
+		books = append(books, &ListBook{id:bookID, name:title, authors:authors})
+	})
+	return books
 }
 
 func parseListItem(s *goquery.Selection) (ListItem, error) {
 	id, hasid := s.Attr("href")
-	if !hasid { panic("unable to parse authorID id") }
+	if !hasid { return nil, fmt.Errorf("%q has no link", s.Text()) }
 	authorID, err := strconv.ParseUint(filepath.Base(id), 10, 0)
-	if err != nil { panic(err) }
+	if err != nil { return nil, fmt.Errorf("%q: %w", s.Text(), err) }
 	return &Author{id:authorID, name:s.Text()}, nil
 }
 
-func (api *API) BookByID(id uint64) (*Book, error) {
-	resp, err := api.c.Get(fmt.Sprintf("%s/book/%d", api.url, id))
+func (api *API) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil { return nil, err }
+	return api.c.Do(req)
+}
+
+func (api *API) BookByID(id uint64) (*Book, error) { return api.bookByID(context.Background(), id) }
+
+func (api *API) bookByID(ctx context.Context, id uint64) (*Book, error) {
+	resp, err := api.get(ctx, fmt.Sprintf("%s/book/%d", api.url, id))
 	if err != nil { return nil, err }
 	defer resp.Body.Close()
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil { return nil, err }
 
-	title := doc.Find("h2#title").Text()
-	authors, categories:= []string{}, []string{}
+	book, err := api.parseBookPage(doc, id)
+	if err != nil && api.opds != nil {
+		// The OPDS entry has less detail but does not depend on the templates
+		var oerr error
+		book, oerr = api.opdsBook(ctx, id, pageTitle(doc))
+		if oerr != nil { return nil, fmt.Errorf("%w, OPDS fallback: %s", err, oerr) }
+	} else if err != nil {
+		return nil, err
+	}
+
+	book.stored = make(BookIdentifiers, len(book.Identifiers))
+	for t, v := range book.Identifiers { book.stored[t] = v }
+	return book, nil
+}
+
+// pageTitle returns the title of a page, which calibre-web writes after the
+// instance name as "Calibre-Web | Title"
+func pageTitle(doc *goquery.Document) string {
+	title := strings.TrimSpace(doc.Find("head title").Text())
+	if i := strings.Index(title, " | "); i >= 0 { return strings.TrimSpace(title[i+3:]) }
+	return ""
+}
+
+// parseBookPage parses a book page, a template it can't read is returned as error
+func (api *API) parseBookPage(doc *goquery.Document, id uint64) (*Book, error) {
+	fail := func(format string, args ...interface{}) (*Book, error) {
+		return nil, fmt.Errorf("book %d: parsing page: %s", id, fmt.Sprintf(format, args...))
+	}
+
+	sel := api.selectors()
+	title := strings.TrimSpace(doc.Find(sel.title).Text())
+	if title == "" { return fail("no title") }
+
+	// listItems reads the names of author, tag and similar links
+	listItems := func(selector string) ([]string, error) {
+		names := []string{}
+		var err error
+		doc.Find(selector).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+			var item ListItem
+			item, err = parseListItem(s)
+			if err != nil { return false }
+			names = append(names, item.Name())
+			return true
+		})
+		return names, err
+	}
 
 	// Authors
-	doc.Find(".author a").Each(func(_ int, s *goquery.Selection) {
-		item, err := parseListItem(s)
-		if err != nil { panic(err) }
-		authors = append(authors, item.Name())
-	})
+	authors, err := listItems(sel.authors)
+	if err != nil { return fail("author %s", err) }
 
 	// Categories
-	doc.Find(".tags a").Each(func(_ int, s *goquery.Selection) {
-		item, err := parseListItem(s)
-		if err != nil { panic(err) }
-		categories = append(categories, item.Name())
-	})
+	categories, err := listItems(sel.tags)
+	if err != nil { return fail("tag %s", err) }
 
 	// Publisher
-	publisher := doc.Find(".publishers a").Text()
+	publisher := doc.Find(sel.publisher).Text()
 
 	// Description
-	c := doc.Find(".comments")
+	c := doc.Find(sel.comments)
 	c.Children().First().Remove()
 	description, err := c.Html()
-	if err != nil { panic(err) }
+	if err != nil { return fail("description: %s", err) }
 	description = strings.TrimSpace(description)
 
 	book := &Book{
@@ -211,53 +289,54 @@ func (api *API) BookByID(id uint64) (*Book, error) {
 	}
 	book.Identifiers = make(BookIdentifiers)
 	book.formats = make(map[Format]bool)
+	book.sizes = make(map[Format]int64)
 
 	// Published
-	if published := doc.Find(".publishing-date p"); len(published.Nodes) > 0 {
-		t, err := time.Parse("Jan _2, 2006 ", published.Text()[11:])
-		if err != nil { return nil, err }
+	if published := doc.Find(sel.published); len(published.Nodes) > 0 {
+		text := published.Text()
+		if len(text) < 11 { return fail("published %q", text) }
+		t, err := time.Parse("Jan _2, 2006 ", text[11:])
+		if err != nil { return fail("published: %s", err) }
 		book.Published = &t
 	}
 
 	// Rating
-	book.Rating = uint8(doc.Find(".rating .good").Length())
+	book.Rating = uint8(doc.Find(sel.rating).Length())
+
+	// Reading state of the current user
+	_, book.read = doc.Find(sel.read).Attr("checked")
+	if sel.archived != "" { _, book.archived = doc.Find(sel.archived).Attr("checked") }
 
 	// Formats
-	doc.Find(".btn-group").Children().First().Find("a").Each(func(_ int, s *goquery.Selection) {
-		sp := strings.Split(strings.TrimSpace(s.Text()), " ")
-		switch sp[0] {
-		case "PDF":
-			book.formats[FormatPDF] = true
-		case "MOBI":
-			book.formats[FormatPDF] = true
-		case "EPUB":
-			book.formats[FormatEPUB] = true
-		case "CBZ":
-			book.formats[FormatCBZ] = true
-		default:
-			panic("unhandled book format " + sp[0])
-		}
+	doc.Find(sel.formats).Each(func(_ int, s *goquery.Selection) {
+		format, ok := parseFormatLink(s)
+		if !ok { return }
+		book.formats[format] = true
+		if size, ok := parseFileSize(s.Text()); ok { book.sizes[format] = size }
 	})
 
 	// Series and Series Index
 	// TODO:Could be unstable
-	s := doc.Find("h2#title").SiblingsFiltered("p").Last()
-	if class, _ := s.Last().Attr("class"); class != "author" {
+	s := doc.Find(sel.title).SiblingsFiltered("p").Last()
+	if class, _ := s.Last().Attr("class"); s.Length() > 0 && class != "author" {
 		sp := strings.Split(s.Text(), " ")
+		if len(sp) < 4 { return fail("series %q", s.Text()) }
 		series := strings.Join(sp[3:], " ")
 		seriesID, err := strconv.ParseFloat(sp[1], 0)
-		if err != nil { panic("failed to parse series id") }
+		if err != nil { return fail("series index: %s", err) }
 
 		book.Series = series
 		book.SeriesIndex = seriesID
 	}
 
 	// Languages
-	if lang := doc.Find(".languages span"); len(lang.Nodes) > 0 {
-		book.Languages = strings.Split(lang.Text()[10:], ", ")
+	if lang := doc.Find(sel.languages); len(lang.Nodes) > 0 {
+		text := lang.Text()
+		if len(text) < 10 { return fail("languages %q", text) }
+		book.Languages = strings.Split(text[10:], ", ")
 	}
 
-	doc.Find(".identifiers a").Each(func(_ int, s *goquery.Selection) {
+	doc.Find(sel.identifiers).Each(func(_ int, s *goquery.Selection) {
 		v, hasLink := s.Attr("href")
 		t := strings.ToLower(s.Text())
 		if hasLink {
@@ -267,44 +346,71 @@ func (api *API) BookByID(id uint64) (*Book, error) {
 			} else if t == "литрес" {
 				t = "litres"
 			}
-			//book.Identifiers = append(book.Identifiers, BookIdentifier{Type:t, Value:link})
-			book.Identifiers[t] = v
+			book.Identifiers[t] = identifierFromLink(t, v)
 		}
 	})
 
 	return book, nil
 }
 
-func (api *API) loadURI(uri string) (uploadcontent.Content, error) {
-	if strings.HasPrefix(uri, "http") {
-		resp, err := api.c.Get(uri)
+// loadURI opens a http(s) or file URL, a data URI, "-" for stdin or a file path
+func (api *API) loadURI(ctx context.Context, uri string) (uploadcontent.Content, error) {
+	switch {
+	case strings.HasPrefix(uri, "http"):
+		resp, err := api.get(ctx, uri)
 		if err != nil { return nil, err }
-		return uploadcontent.ContentFromResponse(resp, true), nil
-	} else {
-		file, err := os.Open(uri)
+		return uploadcontent.ContentFromResponse(resp, api.progress), nil
+	case strings.HasPrefix(uri, "data:"):
+		return uploadcontent.ContentFromDataURI(uri, api.progress)
+	case uri == "-":
+		return uploadcontent.ContentFromReader(ioutil.NopCloser(os.Stdin), "", -1, api.progress)
+	case strings.HasPrefix(uri, "file://"):
+		u, err := url.Parse(uri)
 		if err != nil { return nil, err }
-		return uploadcontent.ContentFromFile(file, true)
+		// Only local files can be opened, file://host/path is not a local path
+		if u.Host != "" && u.Host != "localhost" { return nil, fmt.Errorf("%s: not a local file", uri) }
+		uri = u.Path
 	}
+	file, err := os.Open(uri)
+	if err != nil { return nil, err }
+	return uploadcontent.ContentFromFile(file, api.progress)
 }
 
-func (api *API) Upload(uri string) (*Book, error) {
-	content, err := api.loadURI(uri)
-	if err != nil { return nil, err }
-	defer content.Close()
+func (api *API) Upload(uri string) (*Book, error) { return api.upload(context.Background(), uri, nil) }
 
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
+// UploadNotify is Upload, but calls created with the ID of the new book as
+// soon as calibre-web reports it, before the book is loaded. An error of
+// created is returned and the book stays on the server.
+func (api *API) UploadNotify(uri string, created func(id uint64) error) (*Book, error) {
+	return api.upload(context.Background(), uri, created)
+}
 
-	fw, err := w.CreateFormFile("btn-upload", content.Filename())
+func (api *API) upload(ctx context.Context, uri string, created func(id uint64) error) (*Book, error) {
+	content, err := api.loadURI(ctx, uri)
 	if err != nil { return nil, err }
+	return api.uploadContent(ctx, content, created)
+}
 
-	_, err = io.Copy(fw, content.Reader())
+// UploadReader uploads a book read from r. filename is sent to calibre-web,
+// which uses its extension to detect the format. A size of -1 means unknown.
+func (api *API) UploadReader(ctx context.Context, r io.Reader, filename string, size int64) (*Book, error) {
+	content, err := uploadcontent.ContentFromReader(r, filename, size, api.progress)
 	if err != nil { return nil, err }
+	return api.uploadContent(ctx, content, nil)
+}
+
+// uploadContent creates a book from content, created is called with its ID
+// before the book is loaded when it is not nil
+func (api *API) uploadContent(ctx context.Context, content uploadcontent.Content, created func(id uint64) error) (*Book, error) {
+	defer content.Close()
 
-	err = w.Close()
+	err := uploadcontent.Check(content)
 	if err != nil { return nil, err }
 
-	resp, err := api.c.Post(api.url + "/upload", w.FormDataContentType(), &b)
+	m := newMultipart()
+	m.file("btn-upload", content.Filename(), content.ContentType(), content.Reader(), content.Size())
+
+	resp, err := api.postMultipart(ctx, api.url + "/upload", m)
 	if err != nil { return nil, err }
 	defer resp.Body.Close()
 
@@ -318,96 +424,85 @@ func (api *API) Upload(uri string) (*Book, error) {
 
 	id, err := strconv.ParseUint(filepath.Base(uploadResp.Location), 10, 0)
 	if err != nil { return nil, err }
+	if created != nil {
+		err = created(id)
+		if err != nil { return nil, err }
+	}
 
-	return api.BookByID(id)
+	book, err := api.bookByID(ctx, id)
+	if err != nil { return nil, err }
+	book.setChecksum(content)
+	return book, nil
 }
 
 func (api *API) UpdateBookCover(id uint64, uri string) error {
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
-	if strings.HasPrefix(uri, "http") {
-		err := w.WriteField("cover_url", uri)
-		if err != nil { return err }
-	} else {
+	return api.updateBookCover(context.Background(), id, uri)
+}
+
+func (api *API) updateBookCover(ctx context.Context, id uint64, uri string) error {
+	if !strings.HasPrefix(uri, "http") {
 		file, err := os.Open(uri)
 		if err != nil { return err }
 		defer file.Close()
 
-		// Detect ContentType
-		b := make([]byte, 512)
-		_, err = file.Read(b)
-		if err != nil { return err }
-		contentType := http.DetectContentType(b)
-
-		_, err = file.Seek(0,0)
-		if err != nil { return err }
-
-		// Check if file has valid ContentType
-		if !(contentType == "image/png" || contentType == "image/jpeg" || contentType == "image/webp") {
-			return errors.New("Invalid Content-Type")
-		}
-
-		h := make(textproto.MIMEHeader)
-		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="btn-upload-cover"; filename="%s"`, filepath.Base(uri)))
-		h.Set("Content-Type", contentType)
-		fw, err := w.CreatePart(h)
-		if err != nil { return err }
-
-		_, err = io.Copy(fw, file)
+		c, err := ReadCover(file)
 		if err != nil { return err }
+		return api.postCover(ctx, id, c)
 	}
 
-	err := w.Close()
-	if err != nil { return err }
-
+	m := newMultipart()
+	m.field("cover_url", uri)
 
-	resp, err := api.c.Post(fmt.Sprintf("%s/admin/book/%d", api.url, id), w.FormDataContentType(), &b)
+	resp, err := api.postMultipart(ctx, fmt.Sprintf("%s/admin/book/%d", api.url, id), m)
 	if err != nil { return err }
 	defer resp.Body.Close()
-	return nil
+	return checkFlashAlert(resp)
 }
 
 
 
 func (api *API) UpdateBookMetadata(book *Book) error {
-	w, b, err := book.multipart()
-	if err != nil { return err }
+	return api.updateBookMetadata(context.Background(), book)
+}
 
-	err = w.Close()
+// updateBookMetadata rejects invalid ISBNs, ISSNs and DOIs and saves them
+// normalized. Identifiers unchanged since the book was loaded are saved as is.
+func (api *API) updateBookMetadata(ctx context.Context, book *Book) error {
+	identifiers, err := book.Identifiers.normalizedSince(book.stored)
 	if err != nil { return err }
+	b := *book
+	b.Identifiers = identifiers
 
-	resp, err := api.c.Post(fmt.Sprintf("%s/admin/book/%d", api.url, book.id), w.FormDataContentType(), b)
+	resp, err := api.postMultipart(ctx, fmt.Sprintf("%s/admin/book/%d", api.url, book.id), b.multipart())
 	if err != nil { return err }
 	defer resp.Body.Close()
 	err = checkFlashAlert(resp)
 	if err != nil { return err }
+	book.stored = identifiers
 	return nil
 }
 
 func (api *API) BookUploadFormat(book *Book, uri string) error {
-	r, err := api.loadURI(uri)
-	if err != nil { return err }
-	defer r.Close()
-
-	w, b, err := book.multipart()
+	return api.bookUploadFormat(context.Background(), book, uri)
+}
 
-	h := make(textproto.MIMEHeader)
-	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="btn-upload-format"; filename="%s"`, r.Filename()))
-	h.Set("Content-Type", r.ContentType())
-	f, err := w.CreatePart(h)
-	if err != nil { return err }
-	_, err = io.Copy(f, r.Reader())
+func (api *API) bookUploadFormat(ctx context.Context, book *Book, uri string) error {
+	r, err := api.loadURI(ctx, uri)
 	if err != nil { return err }
+	defer r.Close()
 
-	err = w.Close()
+	err = uploadcontent.Check(r)
 	if err != nil { return err }
 
+	m := book.multipart()
+	m.file("btn-upload-format", r.Filename(), r.ContentType(), r.Reader(), r.Size())
 
-	resp, err := api.c.Post(fmt.Sprintf("%s/admin/book/%d", api.url, book.id), w.FormDataContentType(), b)
+	resp, err := api.postMultipart(ctx, fmt.Sprintf("%s/admin/book/%d", api.url, book.id), m)
 	if err != nil { return err }
 	defer resp.Body.Close()
 	err = checkFlashAlert(resp)
 	if err != nil { return err }
+	book.setChecksum(r)
 	return nil
 }
 
@@ -452,18 +547,52 @@ func (api *API) DeleteBookFormat(id uint64, format Format) error {
 	return nil
 }
 
-func (api *API) DownloadFormat(id uint64, format Format) (file *bytes.Buffer, filename string, err error) {
-	resp, err := api.c.Get(fmt.Sprintf("%s/download/%d/%s/%d.%s", api.url, id, format.Ext(), id, format.Ext()))
-	if err != nil { return nil, "", err }
+type Download struct {
+	Filename string
+	Size int64
+	SHA256 []byte
+}
+
+// DownloadFormatTo writes a format of a book to w. If sum is not nil the
+// SHA-256 of the download is compared with it and a *ChecksumError is returned
+// on mismatch, in which case w has already received the bad data.
+func (api *API) DownloadFormatTo(ctx context.Context, id uint64, format Format, w io.Writer, sum []byte) (*Download, error) {
+	resp, err := api.downloadResponse(ctx, id, format)
+	if err != nil { return nil, err }
 	defer resp.Body.Close()
-	if resp.StatusCode == 404 { return nil, "", ErrNotFound }
 
-	filename, err = url.PathUnescape(strings.Split(resp.Header.Get("Content-Disposition"), "; ")[1][9:])
-	if err != nil { return nil, "", err }
+	if resp.StatusCode != 200 { return nil, fmt.Errorf("book %d: downloading %s: %s", id, format, resp.Status) }
+	filename, err := downloadFilename(resp.Header.Get("Content-Disposition"))
+	if err != nil { return nil, fmt.Errorf("book %d: downloading %s: %w", id, format, err) }
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), progress.Reader(resp.Body, filename, resp.ContentLength, api.progress))
+	if err != nil { return nil, err }
+
+	d := &Download{Filename: filename, Size: n, SHA256: h.Sum(nil)}
+	if sum != nil && !bytes.Equal(sum, d.SHA256) {
+		return d, &ChecksumError{Expected: sum, Actual: d.SHA256}
+	}
+	return d, nil
+}
+
+// downloadFilename reads the file name from a Content-Disposition header.
+// calibre-web percent encodes filename and also sends it as RFC 2231 filename*,
+// which ParseMediaType already decodes.
+func downloadFilename(disposition string) (string, error) {
+	_, params, err := mime.ParseMediaType(disposition)
+	if err != nil { return "", fmt.Errorf("Content-Disposition: %w", err) }
+	filename, ok := params["filename"]
+	if !ok || filename == "" { return "", errors.New("Content-Disposition: no filename") }
+	if strings.Contains(disposition, "filename*=") { return filename, nil }
+	return url.PathUnescape(filename)
+}
+
+func (api *API) DownloadFormat(id uint64, format Format) (file *bytes.Buffer, filename string, err error) {
 	file = new(bytes.Buffer)
-	_, err = io.Copy(file, resp.Body)
+	d, err := api.DownloadFormatTo(context.Background(), id, format, file, nil)
 	if err != nil { return nil, "", err }
-	return file, filename, nil
+	return file, d.Filename, nil
 }
 
 func (api *API) DownloadCover(id uint64) (*bytes.Buffer, error) {
@@ -473,7 +602,7 @@ func (api *API) DownloadCover(id uint64) (*bytes.Buffer, error) {
 	if resp.StatusCode == 404 { return nil, ErrNotFound }
 
 	file := new(bytes.Buffer)
-	_, err = io.Copy(file, resp.Body)
+	_, err = io.Copy(file, progress.Reader(resp.Body, fmt.Sprintf("cover %d", id), resp.ContentLength, api.progress))
 	if err != nil { return nil, err }
 	return file, nil
 }
@@ -486,6 +615,7 @@ func NewAPI(url string) (*API, error) {
 		Jar: jar,
 	}
 	a.url = url
+	a.sel = defaultSelectors
 	return a, nil
 }
 
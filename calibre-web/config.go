@@ -0,0 +1,189 @@
+package calibre
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ConfigSection holds the form values of a configuration page.
+// Checkboxes are "on" when checked and empty otherwise.
+type ConfigSection map[string]string
+
+func (cs ConfigSection) Get(key string) string { return cs[key] }
+func (cs ConfigSection) Bool(key string) bool { return cs[key] == "on" }
+
+func (cs ConfigSection) Int(key string) (int, error) { return strconv.Atoi(cs[key]) }
+
+func (cs ConfigSection) SetBool(key string, v bool) {
+	if v {
+		cs[key] = "on"
+	} else {
+		cs[key] = ""
+	}
+}
+
+func (cs ConfigSection) SetInt(key string, v int) { cs[key] = strconv.Itoa(v) }
+
+// ServerConfig is the basic, UI and mail configuration of calibre-web
+type ServerConfig struct {
+	Basic ConfigSection `json:"basic"`
+	UI ConfigSection `json:"ui"`
+	Mail ConfigSection `json:"mail"`
+}
+
+type configPage struct {
+	name string
+	path string
+	section func(*ServerConfig) *ConfigSection
+}
+
+var configPages = []configPage{
+	{"basic", "/admin/config", func(c *ServerConfig) *ConfigSection { return &c.Basic }},
+	{"ui", "/admin/viewconfig", func(c *ServerConfig) *ConfigSection { return &c.UI }},
+	{"mail", "/admin/mailsettings", func(c *ServerConfig) *ConfigSection { return &c.Mail }},
+}
+
+// parseForm reads the values of the form that posts to path, the page
+// itself. Unchecked checkboxes are kept as empty values, so they can be
+// told apart from keys that are missing in a config file. checkboxes
+// holds the names of all checkboxes.
+func parseForm(doc *goquery.Document, path string) (cs ConfigSection, checkboxes map[string]bool, err error) {
+	cs, checkboxes = ConfigSection{}, map[string]bool{}
+	// Skips the search form of the navigation bar
+	form := doc.Find("form").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		if !strings.EqualFold(s.AttrOr("method", "get"), "post") { return false }
+		action := strings.SplitN(s.AttrOr("action", ""), "?", 2)[0]
+		return action == "" || strings.HasSuffix(action, path)
+	}).First()
+	if form.Length() == 0 { return nil, nil, fmt.Errorf("%s: settings form not found", path) }
+
+	form.Find("input").Each(func(_ int, s *goquery.Selection) {
+		name, ok := s.Attr("name")
+		if !ok || name == "csrf_token" { return }
+		switch t, _ := s.Attr("type"); strings.ToLower(t) {
+		case "submit", "button", "file", "reset":
+		case "checkbox":
+			cs[name], checkboxes[name] = "", true
+			if _, checked := s.Attr("checked"); checked { cs[name] = s.AttrOr("value", "on") }
+		case "radio":
+			if _, checked := s.Attr("checked"); checked { cs[name] = s.AttrOr("value", "on") }
+		default:
+			cs[name] = s.AttrOr("value", "")
+		}
+	})
+
+	form.Find("select").Each(func(_ int, s *goquery.Selection) {
+		name, ok := s.Attr("name")
+		if !ok { return }
+		option := s.Find("option[selected]").First()
+		if option.Length() == 0 { option = s.Find("option").First() }
+		if option.Length() > 0 { cs[name] = option.AttrOr("value", strings.TrimSpace(option.Text())) }
+	})
+
+	form.Find("textarea").Each(func(_ int, s *goquery.Selection) {
+		if name, ok := s.Attr("name"); ok { cs[name] = s.Text() }
+	})
+	return cs, checkboxes, nil
+}
+
+// configPage loads the settings form of a page
+func (api *API) configPage(page configPage) (ConfigSection, map[string]bool, error) {
+	resp, err := api.c.Get(api.url + page.path)
+	if err != nil { return nil, nil, err }
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 { return nil, nil, fmt.Errorf("%s: %s", page.path, resp.Status) }
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil { return nil, nil, err }
+	return parseForm(doc, page.path)
+}
+
+func (api *API) ServerConfig() (*ServerConfig, error) {
+	cfg := new(ServerConfig)
+	for _, page := range configPages {
+		section, _, err := api.configPage(page)
+		if err != nil { return nil, err }
+		*page.section(cfg) = section
+	}
+	return cfg, nil
+}
+
+// UpdateServerConfig posts the sections of cfg that differ from the server.
+// Keys missing from cfg keep their current value, checkboxes are unchecked
+// with an empty value. Empty password fields are not sent, calibre-web never
+// shows the stored passwords.
+func (api *API) UpdateServerConfig(cfg *ServerConfig) error {
+	for _, page := range configPages {
+		want := *page.section(cfg)
+		if want == nil { continue }
+		have, checkboxes, err := api.configPage(page)
+		if err != nil { return err }
+
+		merged := mergeSection(have, want)
+		if len(diffSection(page.name, have, merged)) == 0 { continue }
+
+		data := url.Values{}
+		for k, v := range merged {
+			// Browsers leave out unchecked checkboxes
+			if v == "" && (checkboxes[k] || strings.Contains(k, "password")) { continue }
+			data.Set(k, v)
+		}
+
+		resp, err := api.c.PostForm(api.url + page.path, data)
+		if err != nil { return err }
+		err = checkFlashAlert(resp)
+		resp.Body.Close()
+		if err != nil { return fmt.Errorf("%s: %w", page.path, err) }
+	}
+	return nil
+}
+
+// mergeSection applies want to have, keys missing from want keep their value
+func mergeSection(have, want ConfigSection) ConfigSection {
+	merged := ConfigSection{}
+	for k, v := range have { merged[k] = v }
+	for k, v := range want { merged[k] = v }
+	return merged
+}
+
+type ConfigChange struct {
+	Section string
+	Key string
+	Old, New string
+}
+
+func (c ConfigChange) String() string {
+	return fmt.Sprintf("%s.%s: %q -> %q", c.Section, c.Key, c.Old, c.New)
+}
+
+func diffSection(name string, a, b ConfigSection) []ConfigChange {
+	keys := map[string]bool{}
+	for k := range a { keys[k] = true }
+	for k := range b { keys[k] = true }
+
+	changes := []ConfigChange{}
+	for k := range keys {
+		if a[k] == b[k] { continue }
+		// Passwords are never shown, an empty value is not a change
+		if strings.Contains(k, "password") && (a[k] == "" || b[k] == "") { continue }
+		changes = append(changes, ConfigChange{name, k, a[k], b[k]})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// DiffConfig returns the changes UpdateServerConfig makes to turn a into b.
+// Missing sections of b and keys missing from them are kept.
+func DiffConfig(a, b *ServerConfig) []ConfigChange {
+	changes := []ConfigChange{}
+	for _, page := range configPages {
+		want, have := *page.section(b), *page.section(a)
+		if want == nil { continue }
+		changes = append(changes, diffSection(page.name, have, mergeSection(have, want))...)
+	}
+	return changes
+}
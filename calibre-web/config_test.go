@@ -0,0 +1,122 @@
+package calibre
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// testConfigPage is cut down from admin/config of calibre-web, with the
+// search form of the navigation bar before the settings form
+const testConfigPage = `<!DOCTYPE html>
+<html><head><title>Calibre-Web | Basic Configuration</title></head><body>
+<div class="navbar navbar-default navbar-static-top" role="navigation">
+  <form class="navbar-form navbar-left" role="search" action="/search" method="GET">
+    <div class="form-group input-group input-group-sm">
+      <label for="query" class="sr-only">Search</label>
+      <input type="text" class="form-control" id="query" name="query" placeholder="Search Library" value="">
+    </div>
+  </form>
+</div>
+<div class="container-fluid">
+<div class="discover">
+<h2>Basic Configuration</h2>
+<form role="form" method="POST" autocomplete="off">
+  <input type="hidden" name="csrf_token" value="token">
+  <div class="form-group">
+    <label for="config_port">Server Port</label>
+    <input type="number" min="1" max="65535" class="form-control" name="config_port" id="config_port" value="%s" required>
+  </div>
+  <div class="form-group">
+    <input type="checkbox" id="config_uploading" name="config_uploading" %s>
+    <label for="config_uploading">Enable Uploads</label>
+  </div>
+  <div class="form-group">
+    <input type="checkbox" id="config_public_reg" name="config_public_reg">
+    <label for="config_public_reg">Enable Public Registration</label>
+  </div>
+  <div class="form-group">
+    <label for="config_log_level">Log Level</label>
+    <select name="config_log_level" id="config_log_level" class="form-control">
+      <option value="10">DEBUG</option>
+      <option value="20" selected>INFO</option>
+    </select>
+  </div>
+  <div class="form-group">
+    <label for="config_ldap_serv_password">LDAP Administrator Password</label>
+    <input type="password" class="form-control" id="config_ldap_serv_password" name="config_ldap_serv_password" value="" autocomplete="off">
+  </div>
+  <button type="submit" name="submit" class="btn btn-default">Save</button>
+</form>
+</div></div></body></html>`
+
+func TestParseForm(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(fmt.Sprintf(testConfigPage, "8083", "checked")))
+	if err != nil { t.Fatal(err) }
+	cs, checkboxes, err := parseForm(doc, "/admin/config")
+	if err != nil { t.Fatal(err) }
+	want := ConfigSection{"config_port": "8083", "config_uploading": "on", "config_public_reg": "", "config_log_level": "20", "config_ldap_serv_password": ""}
+	if !reflect.DeepEqual(cs, want) { t.Errorf("got %v, want %v", cs, want) }
+	if !reflect.DeepEqual(checkboxes, map[string]bool{"config_uploading": true, "config_public_reg": true}) { t.Errorf("checkboxes %v", checkboxes) }
+
+	doc, err = goquery.NewDocumentFromReader(strings.NewReader(`<form role="search" action="/search" method="GET"><input name="query"></form>`))
+	if err != nil { t.Fatal(err) }
+	if _, _, err = parseForm(doc, "/admin/config"); err == nil { t.Error("parsed the search form as settings") }
+}
+
+func TestUpdateServerConfigPartial(t *testing.T) {
+	port, uploading := "8083", "checked"
+	var posted string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/admin/config" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodPost {
+			r.ParseForm()
+			posted = r.PostForm.Encode()
+			port = r.PostForm.Get("config_port")
+		}
+		fmt.Fprintf(w, testConfigPage, port, uploading)
+	}))
+	defer server.Close()
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+
+	// Uploads stay enabled although the file doesn't mention them
+	err = api.UpdateServerConfig(&ServerConfig{Basic: ConfigSection{"config_port": "8084"}})
+	if err != nil { t.Fatal(err) }
+	if want := "config_log_level=20&config_port=8084&config_uploading=on"; posted != want { t.Errorf("posted %q, want %q", posted, want) }
+
+	cs := ConfigSection{}
+	cs.SetBool("config_uploading", false)
+	err = api.UpdateServerConfig(&ServerConfig{Basic: cs})
+	if err != nil { t.Fatal(err) }
+	if want := "config_log_level=20&config_port=8084"; posted != want { t.Errorf("posted %q, want %q", posted, want) }
+}
+
+func TestDiffConfig(t *testing.T) {
+	current := &ServerConfig{
+		Basic: ConfigSection{"config_port": "8083", "config_uploading": "on", "config_public_reg": "", "config_title": "Library"},
+		UI: ConfigSection{"config_books_per_page": "60"},
+		Mail: ConfigSection{"mail_server": "mail.example.com", "mail_password": ""},
+	}
+	// UI is missing, the title and uploads are kept
+	cfg := &ServerConfig{
+		Basic: ConfigSection{"config_port": "8084", "config_public_reg": "on"},
+		Mail: ConfigSection{"mail_password": "secret"},
+	}
+	got := DiffConfig(current, cfg)
+	want := []ConfigChange{
+		{"basic", "config_port", "8083", "8084"},
+		{"basic", "config_public_reg", "", "on"},
+	}
+	if !reflect.DeepEqual(got, want) { t.Errorf("got %v, want %v", got, want) }
+
+	if got := DiffConfig(current, current); len(got) != 0 { t.Errorf("config differs from itself: %v", got) }
+}
@@ -0,0 +1,42 @@
+package calibre
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/yrhki/gocalibre/calibre-web/convert"
+)
+
+// ConvertFormat queues the conversion of a book format to another one, like
+// the convert form of the edit page. Use WaitTask to wait for the new format.
+func (api *API) ConvertFormat(id uint64, from, to Format) (*Task, error) {
+	if from == to { return nil, fmt.Errorf("book %d is already %s", id, to) }
+	return api.newTask(id, taskConvert, func() error {
+		data := url.Values{"book_format_from": {from.String()}, "book_format_to": {to.String()}}
+		resp, err := api.c.PostForm(fmt.Sprintf("%s/book/convert/%d", api.url, id), data)
+		if err != nil { return err }
+		defer resp.Body.Close()
+		return checkFlashAlert(resp)
+	})
+}
+
+// UploadConverted converts the local file src with c to every format in
+// formats and uploads the results as formats of book. For servers without
+// conversion configured, where ConvertFormat fails.
+func (api *API) UploadConverted(ctx context.Context, book *Book, c convert.Converter, src string, formats []Format) error {
+	dir, err := ioutil.TempDir("", "calibre-convert")
+	if err != nil { return err }
+	defer os.RemoveAll(dir)
+
+	paths, err := convert.All(ctx, c, src, formats, dir)
+	if err != nil { return err }
+	for _, p := range paths {
+		err = api.bookUploadFormat(ctx, book, p)
+		if err != nil { return fmt.Errorf("%s: %w", filepath.Base(p), err) }
+	}
+	return nil
+}
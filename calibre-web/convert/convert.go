@@ -0,0 +1,103 @@
+// Package convert converts ebooks locally, for servers that have no
+// Calibre conversion configured
+package convert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/yrhki/gocalibre/calibre-web/format"
+)
+
+// Converter converts the file src to a format and writes the result to dir,
+// returning the path of the new file
+type Converter interface {
+	Convert(ctx context.Context, src string, to format.Format, dir string) (string, error)
+}
+
+// outputPath is the file name of src with the extension of to in dir
+func outputPath(src string, to format.Format, dir string) string {
+	name := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	return filepath.Join(dir, name + "." + to.Ext())
+}
+
+// EbookConvert runs the ebook-convert command of Calibre
+type EbookConvert struct {
+	Path string
+	// Args are passed after the input and output file, like --output-profile kindle
+	Args []string
+}
+
+// NewEbookConvert finds ebook-convert in PATH if path is empty
+func NewEbookConvert(path string) (*EbookConvert, error) {
+	if path == "" {
+		p, err := exec.LookPath("ebook-convert")
+		if err != nil { return nil, fmt.Errorf("ebook-convert not found, install Calibre: %w", err) }
+		path = p
+	}
+	return &EbookConvert{Path: path}, nil
+}
+
+func (ec *EbookConvert) Convert(ctx context.Context, src string, to format.Format, dir string) (string, error) {
+	dst := outputPath(src, to, dir)
+	cmd := exec.CommandContext(ctx, ec.Path, append([]string{src, dst}, ec.Args...)...)
+	out := new(bytes.Buffer)
+	cmd.Stdout, cmd.Stderr = out, out
+	err := cmd.Run()
+	if err != nil {
+		// The end of the output has the reason
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		return "", fmt.Errorf("ebook-convert %s: %w: %s", filepath.Base(src), err, lines[len(lines)-1])
+	}
+	return dst, nil
+}
+
+// Call is a conversion requested from a Stub
+type Call struct {
+	Src string
+	To format.Format
+}
+
+// Stub writes Data instead of converting and records the calls. Data should
+// not look like another format, uploads check the content against the extension.
+type Stub struct {
+	Data []byte
+	// Err is returned by every call if set
+	Err error
+
+	mu sync.Mutex
+	Calls []Call
+}
+
+func (s *Stub) Convert(ctx context.Context, src string, to format.Format, dir string) (string, error) {
+	s.mu.Lock()
+	s.Calls = append(s.Calls, Call{src, to})
+	s.mu.Unlock()
+	if s.Err != nil { return "", s.Err }
+	if _, err := os.Stat(src); err != nil { return "", err }
+	dst := outputPath(src, to, dir)
+	return dst, ioutil.WriteFile(dst, s.Data, 0644)
+}
+
+// All converts src to every format in formats, skipping the format of src.
+// The results are written to dir.
+func All(ctx context.Context, c Converter, src string, formats []format.Format, dir string) ([]string, error) {
+	if c == nil { return nil, errors.New("no converter") }
+	from, known := format.FromExt(filepath.Ext(src))
+	paths := []string{}
+	for _, to := range formats {
+		if known && to == from { continue }
+		p, err := c.Convert(ctx, src, to, dir)
+		if err != nil { return paths, err }
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
@@ -0,0 +1,281 @@
+package calibre
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/yrhki/gocalibre/calibre-web/progress"
+)
+
+var ErrInvalidCover = errors.New("invalid cover image")
+
+// coverTypes are the image types calibre-web accepts as cover
+var coverTypes = map[string]string{
+	"image/png": "png",
+	"image/jpeg": "jpg",
+	"image/webp": "webp",
+}
+
+// Cover is an encoded cover image. Width and Height are 0 for
+// images the standard library can't decode, like WebP.
+type Cover struct {
+	Data []byte
+	ContentType string
+	Width, Height int
+}
+
+// CoverOptions controls how a cover is prepared before it is uploaded
+type CoverOptions struct {
+	// MaxWidth and MaxHeight downscale the cover to fit, 0 means no limit
+	MaxWidth, MaxHeight int
+	// JPEG re-encodes the cover as JPEG
+	JPEG bool
+	// Quality of the JPEG encoding, jpeg.DefaultQuality if 0
+	Quality int
+}
+
+func (c *Cover) Ext() string { return coverTypes[c.ContentType] }
+
+// ReadCover reads an encoded image from r and detects its type and dimensions
+func ReadCover(r io.Reader) (*Cover, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil { return nil, err }
+
+	c := &Cover{Data: b, ContentType: http.DetectContentType(b)}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(b)); err == nil {
+		c.Width, c.Height = cfg.Width, cfg.Height
+	}
+	return c, nil
+}
+
+func (c *Cover) prepare(opts *CoverOptions) (*Cover, error) {
+	if opts == nil { opts = &CoverOptions{} }
+	_, allowed := coverTypes[c.ContentType]
+	resize := opts.MaxWidth > 0 && c.Width > opts.MaxWidth || opts.MaxHeight > 0 && c.Height > opts.MaxHeight
+	if allowed && !resize && (!opts.JPEG || c.ContentType == "image/jpeg") { return c, nil }
+
+	img, _, err := image.Decode(bytes.NewReader(c.Data))
+	if err != nil { return nil, fmt.Errorf("%w: %s: %v", ErrInvalidCover, c.ContentType, err) }
+	return encodeCover(img, opts)
+}
+
+// encodeCover downscales img to fit opts and encodes it as JPEG
+func encodeCover(img image.Image, opts *CoverOptions) (*Cover, error) {
+	if opts == nil { opts = &CoverOptions{} }
+	img = downscale(img, opts.MaxWidth, opts.MaxHeight)
+
+	quality := opts.Quality
+	if quality == 0 { quality = jpeg.DefaultQuality }
+
+	var b bytes.Buffer
+	err := jpeg.Encode(&b, img, &jpeg.Options{Quality: quality})
+	if err != nil { return nil, err }
+
+	bounds := img.Bounds()
+	return &Cover{Data: b.Bytes(), ContentType: "image/jpeg", Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
+
+// downscale shrinks img to fit in maxWidth x maxHeight keeping the aspect
+// ratio, averaging the source pixels covered by each destination pixel
+func downscale(img image.Image, maxWidth, maxHeight int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	scale := 1.0
+	if maxWidth > 0 && w > maxWidth { scale = float64(maxWidth) / float64(w) }
+	if maxHeight > 0 && float64(h) * scale > float64(maxHeight) { scale = float64(maxHeight) / float64(h) }
+	if scale == 1.0 { return img }
+
+	dw, dh := int(float64(w) * scale), int(float64(h) * scale)
+	if dw < 1 { dw = 1 }
+	if dh < 1 { dh = 1 }
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := b.Min.Y + y * h / dh, b.Min.Y + (y + 1) * h / dh
+		for x := 0; x < dw; x++ {
+			x0, x1 := b.Min.X + x * w / dw, b.Min.X + (x + 1) * w / dw
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r + uint64(cr), g + uint64(cg), bl + uint64(cb), a + uint64(ca), n + 1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+func (api *API) postCover(ctx context.Context, id uint64, c *Cover) error {
+	if _, ok := coverTypes[c.ContentType]; !ok { return fmt.Errorf("%w: %s", ErrInvalidCover, c.ContentType) }
+
+	m := newMultipart()
+	m.file("btn-upload-cover", "cover." + c.Ext(), c.ContentType, bytes.NewReader(c.Data), int64(len(c.Data)))
+
+	resp, err := api.postMultipart(ctx, fmt.Sprintf("%s/admin/book/%d", api.url, id), m)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	return checkFlashAlert(resp)
+}
+
+// SetCover uploads the image read from r as cover of a book. Images calibre-web
+// doesn't accept are converted to JPEG. The uploaded cover is returned.
+func (api *API) SetCover(ctx context.Context, id uint64, r io.Reader, opts *CoverOptions) (*Cover, error) {
+	c, err := ReadCover(r)
+	if err != nil { return nil, err }
+	c, err = c.prepare(opts)
+	if err != nil { return nil, err }
+	return c, api.postCover(ctx, id, c)
+}
+
+// SetCoverImage encodes img as JPEG and uploads it as cover of a book
+func (api *API) SetCoverImage(ctx context.Context, id uint64, img image.Image, opts *CoverOptions) (*Cover, error) {
+	c, err := encodeCover(img, opts)
+	if err != nil { return nil, err }
+	return c, api.postCover(ctx, id, c)
+}
+
+type CoverSize uint8
+
+const (
+	CoverOriginal CoverSize = iota
+	CoverSmall
+	CoverMedium
+)
+
+// String is the resolution name calibre-web uses for thumbnails
+func (s CoverSize) String() string {
+	switch s {
+	case CoverSmall:
+		return "sm"
+	case CoverMedium:
+		return "md"
+	default:
+		return "og"
+	}
+}
+
+func (s CoverSize) url(api *API, id uint64) string {
+	if s == CoverOriginal { return fmt.Sprintf("%s/cover/%d", api.url, id) }
+	return fmt.Sprintf("%s/cover/%d/%s", api.url, id, s)
+}
+
+// DownloadCoverSize downloads a cover thumbnail. calibre-web only has
+// thumbnails if thumbnail generation is enabled, otherwise it serves the original.
+func (api *API) DownloadCoverSize(id uint64, size CoverSize) (*bytes.Buffer, error) {
+	resp, err := api.c.Get(size.url(api, id))
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	if resp.StatusCode == 404 { return nil, ErrNotFound }
+	err = checkImageResponse(resp)
+	if err != nil { return nil, err }
+
+	file := new(bytes.Buffer)
+	_, err = io.Copy(file, progress.Reader(resp.Body, fmt.Sprintf("cover %d %s", id, size), resp.ContentLength, api.progress))
+	if err != nil { return nil, err }
+	return file, nil
+}
+
+// Cover downloads the cover of a book
+func (api *API) Cover(ctx context.Context, id uint64) (*Cover, error) {
+	return api.FetchCover(ctx, fmt.Sprintf("%s/cover/%d", api.url, id))
+}
+
+// FetchCover downloads a cover image from url, pages that are no image
+// like login redirects are returned as error
+func (api *API) FetchCover(ctx context.Context, url string) (*Cover, error) {
+	resp, err := api.get(ctx, url)
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	if resp.StatusCode == 404 { return nil, ErrNotFound }
+	err = checkImageResponse(resp)
+	if err != nil { return nil, err }
+	return ReadCover(resp.Body)
+}
+
+// coverSignature identifies a cover file, sum is only set for GET requests
+type coverSignature struct {
+	etag string
+	length int64
+	sum []byte
+}
+
+// coverSignature requests a cover with method, ErrNotFound is returned if the
+// book has no cover at all
+func (api *API) coverSignature(ctx context.Context, method, url string) (*coverSignature, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil { return nil, err }
+	resp, err := api.c.Do(req)
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	if resp.StatusCode == 404 { return nil, ErrNotFound }
+	err = checkImageResponse(resp)
+	if err != nil { return nil, err }
+
+	sig := &coverSignature{etag: resp.Header.Get("ETag"), length: resp.ContentLength}
+	if method == http.MethodGet {
+		h := sha256.New()
+		_, err = io.Copy(h, resp.Body)
+		if err != nil { return nil, err }
+		sig.sum = h.Sum(nil)
+	}
+	return sig, nil
+}
+
+// checkImageResponse returns an error unless resp is an image, a login
+// redirect or an error page is HTML
+func checkImageResponse(resp *http.Response) error {
+	if resp.StatusCode != 200 { return fmt.Errorf("%s: %s", resp.Request.URL.Redacted(), resp.Status) }
+	if t := resp.Header.Get("Content-Type"); t != "" && !strings.HasPrefix(t, "image/") {
+		return fmt.Errorf("%s: not an image: %s", resp.Request.URL.Redacted(), t)
+	}
+	return nil
+}
+
+// genericSignature loads the generic cover, errors are not kept so a later
+// call tries again
+func (api *API) genericSignature(ctx context.Context) (*coverSignature, error) {
+	api.genericMu.Lock()
+	defer api.genericMu.Unlock()
+	if api.genericCover != nil { return api.genericCover, nil }
+	sig, err := api.coverSignature(ctx, http.MethodGet, api.url + "/static/generic_cover.jpg")
+	if err != nil { return nil, fmt.Errorf("generic cover: %w", err) }
+	api.genericCover = sig
+	return sig, nil
+}
+
+// HasCover reports whether a book has a cover. calibre-web serves a generic
+// cover for books without one, which is downloaded once to compare with.
+// Covers are compared by ETag or size with a HEAD request and only downloaded
+// if those can't tell them apart.
+func (api *API) HasCover(ctx context.Context, id uint64) (bool, error) {
+	generic, err := api.genericSignature(ctx)
+	if err != nil { return false, err }
+
+	url := CoverOriginal.url(api, id)
+	head, err := api.coverSignature(ctx, http.MethodHead, url)
+	if err == ErrNotFound { return false, nil }
+	if err != nil { return false, err }
+	// Both are served as files, so the generic cover has the same ETag everywhere
+	if head.etag != "" && generic.etag != "" { return head.etag != generic.etag, nil }
+	if head.length >= 0 && generic.length >= 0 && head.length != generic.length { return true, nil }
+
+	full, err := api.coverSignature(ctx, http.MethodGet, url)
+	if err == ErrNotFound { return false, nil }
+	if err != nil { return false, err }
+	return !bytes.Equal(full.sum, generic.sum), nil
+}
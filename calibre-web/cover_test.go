@@ -0,0 +1,125 @@
+package calibre
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// coverServer serves the generic cover for book 1, an own cover for book 2,
+// nothing for book 3 and a login page for book 4. Without etags the own
+// cover has the size of the generic one.
+func coverServer(t *testing.T, etags bool) (*API, map[string]int) {
+	var mu sync.Mutex
+	gets := map[string]int{}
+	serve := func(w http.ResponseWriter, r *http.Request, etag, body string) {
+		if etags { w.Header().Set("ETag", etag) }
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		if r.Method == http.MethodGet { w.Write([]byte(body)) }
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			gets[r.URL.Path]++
+			mu.Unlock()
+		}
+		switch r.URL.Path {
+		case "/static/generic_cover.jpg", "/cover/1":
+			serve(w, r, `"generic"`, "generic")
+		case "/cover/2":
+			serve(w, r, `"own"`, "ownown!")
+		case "/cover/4":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>login</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+	return api, gets
+}
+
+func TestHasCover(t *testing.T) {
+	for _, etags := range []bool{true, false} {
+		api, gets := coverServer(t, etags)
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for id, want := range map[uint64]bool{1: false, 2: true, 3: false} {
+					got, err := api.HasCover(context.Background(), id)
+					if err != nil || got != want { t.Errorf("etags %v: HasCover(%d) = %v, %v", etags, id, got, err) }
+				}
+			}()
+		}
+		wg.Wait()
+
+		if _, err := api.HasCover(context.Background(), 4); err == nil { t.Errorf("etags %v: login page was read as cover", etags) }
+		if gets["/static/generic_cover.jpg"] != 1 { t.Errorf("etags %v: generic cover downloaded %d times", etags, gets["/static/generic_cover.jpg"]) }
+		if etags && (gets["/cover/1"] > 0 || gets["/cover/2"] > 0) { t.Errorf("covers were downloaded although the etags differ: %v", gets) }
+		if !etags && gets["/cover/2"] == 0 { t.Error("cover of the size of the generic one was not compared") }
+	}
+}
+
+func TestCoverRejectsPages(t *testing.T) {
+	api, _ := coverServer(t, true)
+	if _, err := api.Cover(context.Background(), 4); err == nil || !strings.Contains(err.Error(), "not an image: text/html") { t.Errorf("login page: got error %v", err) }
+	if _, err := api.Cover(context.Background(), 3); err != ErrNotFound { t.Errorf("missing cover: got error %v", err) }
+	if _, err := api.DownloadCoverSize(4, CoverSmall); err == nil { t.Error("downloaded the login page as thumbnail") }
+
+	img := new(bytes.Buffer)
+	if err := png.Encode(img, image.NewGray(image.Rect(0, 0, 3, 4))); err != nil { t.Fatal(err) }
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(img.Bytes())
+	}))
+	defer server.Close()
+	c, err := api.FetchCover(context.Background(), server.URL + "/cover.png")
+	if err != nil { t.Fatal(err) }
+	if c.Width != 3 || c.Height != 4 || c.ContentType != "image/png" { t.Errorf("got %dx%d %s", c.Width, c.Height, c.ContentType) }
+}
+
+func TestHasCoverRetriesGenericCover(t *testing.T) {
+	api, gets := coverServer(t, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := api.HasCover(ctx, 2); err == nil { t.Fatal("HasCover with cancelled context succeeded") }
+
+	got, err := api.HasCover(context.Background(), 2)
+	if err != nil || !got { t.Errorf("HasCover after failure = %v, %v", got, err) }
+	if _, err = api.HasCover(context.Background(), 1); err != nil { t.Fatal(err) }
+	if gets["/static/generic_cover.jpg"] != 1 { t.Errorf("generic cover loaded %d times", gets["/static/generic_cover.jpg"]) }
+}
+
+func TestSetCoverChecksResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/admin/book/1":
+			w.Write([]byte(`<html><body><div id="flash_success">Metadata successfully updated</div></body></html>`))
+		case "/admin/book/2":
+			w.Write([]byte(`<html><body><div id="flash_danger">You are missing permissions to upload cover images</div></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+
+	img := image.NewGray(image.Rect(0, 0, 3, 4))
+	if _, err = api.SetCoverImage(context.Background(), 1, img, nil); err != nil { t.Errorf("accepted cover: %v", err) }
+	if _, err = api.SetCoverImage(context.Background(), 2, img, nil); err == nil || !strings.Contains(err.Error(), "missing permissions") { t.Errorf("rejected cover: got error %v", err) }
+	if _, err = api.SetCoverImage(context.Background(), 3, img, nil); err == nil { t.Error("cover of a missing book was accepted") }
+	if err = api.UpdateBookCover(2, "https://example.com/cover.jpg"); err == nil { t.Error("rejected cover URL was accepted") }
+}
@@ -0,0 +1,85 @@
+package calibre
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CoverCache keeps covers on disk and only downloads them again if
+// calibre-web reports a newer Last-Modified time for them
+type CoverCache struct {
+	api *API
+	dir string
+}
+
+func NewCoverCache(api *API, dir string) (*CoverCache, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil { return nil, err }
+	return &CoverCache{api: api, dir: dir}, nil
+}
+
+// The modification time of the file is the Last-Modified time of the cover
+func (cc *CoverCache) path(id uint64, size CoverSize) string {
+	return filepath.Join(cc.dir, fmt.Sprintf("%d-%s", id, size))
+}
+
+// Get returns the cover from the cache if it is still current, otherwise it is downloaded
+func (cc *CoverCache) Get(ctx context.Context, id uint64, size CoverSize) (*Cover, error) {
+	path := cc.path(id, size)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, size.url(cc.api, id), nil)
+	if err != nil { return nil, err }
+	if fi, err := os.Stat(path); err == nil {
+		req.Header.Set("If-Modified-Since", fi.ModTime().UTC().Format(http.TimeFormat))
+	}
+
+	resp, err := cc.api.c.Do(req)
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		b, err := ioutil.ReadFile(path)
+		if err != nil { return nil, err }
+		return ReadCover(bytes.NewReader(b))
+	case http.StatusNotFound:
+		os.Remove(path)
+		return nil, ErrNotFound
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("downloading cover %d: %s", id, resp.Status)
+	}
+
+	err = checkImageResponse(resp)
+	if err != nil { return nil, err }
+	c, err := ReadCover(resp.Body)
+	if err != nil { return nil, err }
+
+	modified, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		// Without Last-Modified the cover is revalidated against the download time
+		modified = time.Now()
+	}
+
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, c.Data, 0644)
+	if err != nil { return nil, err }
+	err = os.Chtimes(tmp, modified, modified)
+	if err != nil { return nil, err }
+	return c, os.Rename(tmp, path)
+}
+
+// Remove deletes all cached sizes of a cover
+func (cc *CoverCache) Remove(id uint64) error {
+	for _, size := range []CoverSize{CoverOriginal, CoverSmall, CoverMedium} {
+		err := os.Remove(cc.path(id, size))
+		if err != nil && !os.IsNotExist(err) { return err }
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package calibre
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCoverCache(t *testing.T) {
+	img := new(bytes.Buffer)
+	if err := png.Encode(img, image.NewGray(image.Rect(0, 0, 3, 4))); err != nil { t.Fatal(err) }
+	modified := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cover/1":
+			if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			downloads++
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+			w.Write(img.Bytes())
+		case "/cover/2":
+			// A login page served instead of the cover
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>login</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+	cc, err := NewCoverCache(api, t.TempDir())
+	if err != nil { t.Fatal(err) }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		c, err := cc.Get(ctx, 1, CoverOriginal)
+		if err != nil { t.Fatal(err) }
+		if c.Width != 3 || c.Height != 4 { t.Errorf("got %dx%d", c.Width, c.Height) }
+	}
+	if downloads != 1 { t.Errorf("downloaded %d times, want once", downloads) }
+	if fi, err := os.Stat(cc.path(1, CoverOriginal)); err != nil || !fi.ModTime().Equal(modified) { t.Errorf("cached file %v, %v", fi, err) }
+
+	modified = modified.Add(time.Hour)
+	if _, err = cc.Get(ctx, 1, CoverOriginal); err != nil || downloads != 2 { t.Errorf("changed cover: %d downloads, %v", downloads, err) }
+
+	if _, err = cc.Get(ctx, 2, CoverOriginal); err == nil { t.Error("login page was returned as cover") }
+	if _, err = os.Stat(cc.path(2, CoverOriginal)); !os.IsNotExist(err) { t.Errorf("login page was cached: %v", err) }
+
+	// A stale file of a deleted cover is removed
+	if err = ioutil.WriteFile(cc.path(3, CoverOriginal), img.Bytes(), 0644); err != nil { t.Fatal(err) }
+	if _, err = cc.Get(ctx, 3, CoverOriginal); err != ErrNotFound { t.Errorf("missing cover: got error %v", err) }
+	if _, err = os.Stat(cc.path(3, CoverOriginal)); !os.IsNotExist(err) { t.Errorf("stale cover kept: %v", err) }
+}
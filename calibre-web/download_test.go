@@ -0,0 +1,51 @@
+package calibre
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDownloadFilename(t *testing.T) {
+	tests := map[string]string{
+		`attachment; filename=Mort%20-%20Terry%20Pratchett.epub`: "Mort - Terry Pratchett.epub",
+		`attachment; filename="Mort.epub"`: "Mort.epub",
+		`attachment; filename=Sch%C3%B6n.epub; filename*=UTF-8''Sch%C3%B6n.epub`: "Schön.epub",
+		`attachment; filename*=UTF-8''100%25.epub`: "100%.epub",
+		`attachment`: "",
+		``: "",
+		`attachment; filename=`: "",
+	}
+	for header, want := range tests {
+		got, err := downloadFilename(header)
+		if want == "" && err == nil { t.Errorf("%q: got %q, want error", header, got) }
+		if want != "" && (err != nil || got != want) { t.Errorf("%q: got %q, %v, want %q", header, got, err, want) }
+	}
+}
+
+func TestDownloadFormatToChecksHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/download/1/epub/1.epub":
+			w.Header().Set("Content-Disposition", "attachment; filename=Mort.epub")
+			w.Write([]byte("epub"))
+		case "/download/2/epub/2.epub":
+			// A login page instead of the file
+			w.Write([]byte("<html>login</html>"))
+		default:
+			http.Error(w, "forbidden", http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+
+	d, err := api.DownloadFormatTo(context.Background(), 1, FormatEPUB, ioutil.Discard, nil)
+	if err != nil || d.Filename != "Mort.epub" || d.Size != 4 { t.Errorf("got %+v, %v", d, err) }
+	if _, err = api.DownloadFormatTo(context.Background(), 1, FormatEPUB, ioutil.Discard, []byte("wrong")); err == nil { t.Error("checksum mismatch not reported") }
+	for _, id := range []uint64{2, 3} {
+		if _, err = api.DownloadFormatTo(context.Background(), id, FormatEPUB, ioutil.Discard, nil); err == nil { t.Errorf("book %d: download without file succeeded", id) }
+	}
+}
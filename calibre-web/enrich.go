@@ -0,0 +1,117 @@
+package calibre
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yrhki/gocalibre/calibre-web/metadata/provider"
+)
+
+// MetadataFields are the fields MergeCandidate can copy
+var MetadataFields = []string{"title", "authors", "publisher", "published", "description", "tags", "languages", "series", "identifiers"}
+
+// DefaultMetadataFields leaves out languages, calibre-web shows them by
+// their name in the language of the user and only English names are known
+var DefaultMetadataFields = []string{"title", "authors", "publisher", "published", "description", "tags", "series", "identifiers"}
+
+// languageNames maps the ISO 639 codes providers return to the English
+// names calibre-web shows
+var languageNames = map[string]string{
+	"en": "English", "eng": "English",
+	"de": "German", "deu": "German", "ger": "German",
+	"fr": "French", "fra": "French", "fre": "French",
+	"es": "Spanish", "spa": "Spanish",
+	"it": "Italian", "ita": "Italian",
+	"nl": "Dutch", "nld": "Dutch", "dut": "Dutch",
+	"pt": "Portuguese", "por": "Portuguese",
+	"ru": "Russian", "rus": "Russian",
+	"pl": "Polish", "pol": "Polish",
+	"cs": "Czech", "ces": "Czech", "cze": "Czech",
+	"sv": "Swedish", "swe": "Swedish",
+	"da": "Danish", "dan": "Danish",
+	"no": "Norwegian", "nor": "Norwegian",
+	"fi": "Finnish", "fin": "Finnish",
+	"hu": "Hungarian", "hun": "Hungarian",
+	"el": "Greek", "ell": "Greek", "gre": "Greek",
+	"tr": "Turkish", "tur": "Turkish",
+	"ja": "Japanese", "jpn": "Japanese",
+	"zh": "Chinese", "zho": "Chinese", "chi": "Chinese",
+	"la": "Latin", "lat": "Latin",
+}
+
+// languageName returns the name of a language code, names are kept
+func languageName(code string) (string, bool) {
+	if name, ok := languageNames[strings.ToLower(code)]; ok { return name, true }
+	for _, name := range languageNames {
+		if strings.EqualFold(name, code) { return name, true }
+	}
+	return "", false
+}
+
+// MetadataQuery describes a book for metadata providers
+func MetadataQuery(book *Book) provider.Query {
+	isbn, _ := book.Identifiers.ISBN()
+	return provider.Query{Title: book.Title, Authors: book.Authors, ISBN: isbn}
+}
+
+// MergeCandidate copies fields of c that are not empty into book and returns
+// the names of the fields that changed. Tags and identifiers are added to
+// the existing ones. Language codes are replaced by their English name,
+// unknown codes are left out.
+func MergeCandidate(book *Book, c provider.Candidate, fields []string) ([]string, error) {
+	changed := []string{}
+	set := func(name string, differs bool) {
+		if differs { changed = append(changed, name) }
+	}
+	for _, field := range fields {
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "title":
+			if c.Title == "" { continue }
+			set("title", book.Title != c.Title)
+			book.Title = c.Title
+		case "authors":
+			if len(c.Authors) == 0 { continue }
+			set("authors", strings.Join(book.Authors, "&") != strings.Join(c.Authors, "&"))
+			book.Authors = c.Authors
+		case "publisher":
+			if c.Publisher == "" { continue }
+			set("publisher", book.Publisher != c.Publisher)
+			book.Publisher = c.Publisher
+		case "published":
+			if c.Published == nil { continue }
+			set("published", book.Published == nil || !book.Published.Equal(*c.Published))
+			book.Published = c.Published
+		case "description":
+			if c.Description == "" { continue }
+			set("description", book.Description != c.Description)
+			book.Description = c.Description
+		case "tags":
+			tags := diffTags(c.Tags, book.Categories)
+			set("tags", len(tags) > 0)
+			book.Categories = append(book.Categories, tags...)
+		case "languages":
+			languages := []string{}
+			for _, code := range c.Languages {
+				if name, ok := languageName(code); ok { languages = append(languages, name) }
+			}
+			if len(languages) == 0 { continue }
+			set("languages", !strings.EqualFold(strings.Join(book.Languages, ","), strings.Join(languages, ",")))
+			book.Languages = languages
+		case "series":
+			if c.Series == "" { continue }
+			set("series", book.Series != c.Series || book.SeriesIndex != c.SeriesIndex)
+			book.Series, book.SeriesIndex = c.Series, c.SeriesIndex
+		case "identifiers":
+			if book.Identifiers == nil { book.Identifiers = make(BookIdentifiers) }
+			differs := false
+			for t, v := range c.Identifiers {
+				if book.Identifiers[t] != v { differs = true }
+				book.Identifiers[t] = v
+			}
+			set("identifiers", differs)
+		default:
+			return nil, fmt.Errorf("unknown metadata field %q", field)
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,81 @@
+package calibre
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yrhki/gocalibre/calibre-web/metadata/provider"
+)
+
+func TestMergeCandidate(t *testing.T) {
+	published := time.Date(1954, time.July, 29, 0, 0, 0, 0, time.UTC)
+	candidate := provider.Candidate{
+		Title: "The Fellowship of the Ring",
+		Authors: []string{"J.R.R. Tolkien"},
+		Publisher: "Allen & Unwin",
+		Published: &published,
+		Tags: []string{"Fantasy", "Classics"},
+		Languages: []string{"eng"},
+		Identifiers: map[string]string{"isbn": "9780261102354", "openlibrary": "OL27513W"},
+	}
+	book := &Book{
+		Title: "The Fellowship of the Ring",
+		Authors: []string{"Tolkien, J.R.R."},
+		Description: "Kept",
+		Categories: []string{"Fantasy"},
+		// calibre-web shows names, providers return codes
+		Languages: []string{"English"},
+		Identifiers: BookIdentifiers{"isbn": "9780261102354", "goodreads": "34"},
+	}
+
+	changed, err := MergeCandidate(book, candidate, MetadataFields)
+	if err != nil { t.Fatal(err) }
+	if want := []string{"authors", "publisher", "published", "tags", "identifiers"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed %q, want %q", changed, want)
+	}
+	if book.Description != "Kept" { t.Errorf("empty description overwrote %q", book.Description) }
+	if want := []string{"Fantasy", "Classics"}; !reflect.DeepEqual(book.Categories, want) { t.Errorf("tags %q, want %q", book.Categories, want) }
+	if want := (BookIdentifiers{"isbn": "9780261102354", "goodreads": "34", "openlibrary": "OL27513W"}); !reflect.DeepEqual(book.Identifiers, want) {
+		t.Errorf("identifiers %v, want %v", book.Identifiers, want)
+	}
+
+	changed, err = MergeCandidate(book, candidate, MetadataFields)
+	if err != nil { t.Fatal(err) }
+	if len(changed) != 0 { t.Errorf("second merge changed %q", changed) }
+}
+
+func TestMergeCandidateFields(t *testing.T) {
+	book := &Book{Title: "Old", Publisher: "Old"}
+	candidate := provider.Candidate{Title: "New", Publisher: "New", Identifiers: map[string]string{"isbn": "9780261102354"}}
+
+	changed, err := MergeCandidate(book, candidate, []string{" Title ", "identifiers"})
+	if err != nil { t.Fatal(err) }
+	if want := []string{"title", "identifiers"}; !reflect.DeepEqual(changed, want) { t.Errorf("changed %q, want %q", changed, want) }
+	if book.Publisher != "Old" { t.Errorf("publisher %q was not selected", book.Publisher) }
+	if book.Identifiers["isbn"] != "9780261102354" { t.Errorf("identifiers %v of a book without identifiers", book.Identifiers) }
+
+	_, err = MergeCandidate(book, candidate, []string{"cover"})
+	if err == nil { t.Error("unknown field was accepted") }
+}
+
+func TestMergeCandidateLanguages(t *testing.T) {
+	tests := []struct {
+		book, codes, want []string
+		changed bool
+	}{
+		{[]string{"English"}, []string{"eng"}, []string{"English"}, false},
+		{[]string{"English"}, []string{"en"}, []string{"English"}, false},
+		{[]string{"English"}, []string{"ger", "en"}, []string{"German", "English"}, true},
+		{[]string{"English"}, []string{"xx"}, []string{"English"}, false},
+		{nil, []string{"French"}, []string{"French"}, true},
+	}
+	for _, test := range tests {
+		book := &Book{Languages: test.book}
+		changed, err := MergeCandidate(book, provider.Candidate{Languages: test.codes}, []string{"languages"})
+		if err != nil { t.Fatal(err) }
+		if (len(changed) > 0) != test.changed || !reflect.DeepEqual(book.Languages, test.want) {
+			t.Errorf("%q with %q: got %q, changed %q", test.book, test.codes, book.Languages, changed)
+		}
+	}
+}
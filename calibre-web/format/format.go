@@ -0,0 +1,134 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Format uint8
+
+const (
+	PDF Format = iota
+	MOBI
+	EPUB
+	AZW3
+	DOCX
+	RTF
+	FB2
+	LIT
+	LRF
+	TXT
+	HTMLZ
+	ODT
+	CBZ
+	CBR
+	CB7
+)
+
+var All = []Format{PDF, MOBI, EPUB, AZW3, DOCX, RTF, FB2, LIT, LRF, TXT, HTMLZ, ODT, CBZ, CBR, CB7}
+
+func (f Format) Ext() string {
+	switch f {
+	case PDF:
+		return "pdf"
+	case EPUB:
+		return "epub"
+	case MOBI:
+		return "mobi"
+	case AZW3:
+		return "azw3"
+	case DOCX:
+		return "docx"
+	case RTF:
+		return "rtf"
+	case FB2:
+		return "fb2"
+	case LIT:
+		return "lit"
+	case LRF:
+		return "lrf"
+	case TXT:
+		return "txt"
+	case HTMLZ:
+		return "htmlz"
+	case ODT:
+		return "odt"
+	case CBZ:
+		return "cbz"
+	case CBR:
+		return "cbr"
+	case CB7:
+		return "cb7"
+	default:
+		panic(fmt.Sprintf("unhandled format %d", f))
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case PDF:
+		return "application/pdf"
+	case EPUB:
+		return "application/epub+zip"
+	case MOBI:
+		return "application/x-mobipocket-ebook"
+	case AZW3:
+		return "application/vnd.amazon.ebook"
+	case DOCX:
+		return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	case RTF:
+		return "application/rtf"
+	case FB2:
+		return "application/x-fictionbook+xml"
+	case LIT:
+		return "application/x-ms-reader"
+	case LRF:
+		return "application/x-sony-bbeb"
+	case TXT:
+		return "text/plain"
+	case HTMLZ:
+		return "application/zip"
+	case ODT:
+		return "application/vnd.oasis.opendocument.text"
+	case CBZ:
+		return "application/vnd.comicbook+zip"
+	case CBR:
+		return "application/vnd.comicbook-rar"
+	case CB7:
+		return "application/x-cb7"
+	default:
+		panic(fmt.Sprintf("unhandled format %d", f))
+	}
+}
+
+func (f Format) String() string { return strings.ToUpper(f.Ext()) }
+
+// FromExt returns the format for a file extension, with or without a leading dot
+func FromExt(ext string) (Format, bool) {
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	for _, f := range All {
+		if f.Ext() == ext { return f, true }
+	}
+	return 0, false
+}
+
+// FromContentType returns the format for a MIME type. application/zip is
+// not a single format and is not matched.
+func FromContentType(contentType string) (Format, bool) {
+	contentType = strings.ToLower(contentType)
+	if contentType == "application/zip" { return 0, false }
+	for _, f := range All {
+		if f.ContentType() == contentType { return f, true }
+	}
+	return 0, false
+}
+
+// MarshalText encodes a format as its extension
+func (f Format) MarshalText() ([]byte, error) { return []byte(f.Ext()), nil }
+
+func (f *Format) UnmarshalText(text []byte) error {
+	format, ok := FromExt(string(text))
+	if !ok { return fmt.Errorf("unknown format %q", text) }
+	*f = format
+	return nil
+}
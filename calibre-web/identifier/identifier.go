@@ -0,0 +1,134 @@
+// Package identifier validates and normalises ISBN, ISSN and DOI identifiers
+package identifier
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidISBN = errors.New("invalid ISBN")
+	ErrInvalidISSN = errors.New("invalid ISSN")
+	ErrInvalidDOI = errors.New("invalid DOI")
+)
+
+// isbnLabel matches labels like "ISBN", "ISBN:", "ISBN-13:" and "ISBN10 "
+var isbnLabel = regexp.MustCompile(`^ISBN(?:[-\s]?1[03](?:\s*:|\s))?`)
+
+// CleanISBN removes separators and a leading "ISBN" label without validating
+func CleanISBN(s string) string {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = isbnLabel.ReplaceAllString(s, "")
+	s = strings.TrimLeft(s, "-: ")
+	return strings.NewReplacer("-", "", " ", "", "‐", "", "‑", "").Replace(s)
+}
+
+func digits(s string, checkX bool) bool {
+	for i, r := range s {
+		if r >= '0' && r <= '9' { continue }
+		if checkX && r == 'X' && i == len(s) - 1 { continue }
+		return false
+	}
+	return true
+}
+
+func isbn10Check(s string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ { sum += int(s[i] - '0') * (10 - i) }
+	check := (11 - sum % 11) % 11
+	if check == 10 { return 'X' }
+	return byte('0' + check)
+}
+
+func isbn13Check(s string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(s[i] - '0')
+		if i % 2 == 1 { d *= 3 }
+		sum += d
+	}
+	return byte('0' + (10 - sum % 10) % 10)
+}
+
+func ValidISBN10(s string) bool {
+	s = CleanISBN(s)
+	return len(s) == 10 && digits(s, true) && s[9] == isbn10Check(s)
+}
+
+func ValidISBN13(s string) bool {
+	s = CleanISBN(s)
+	return len(s) == 13 && digits(s, false) && (strings.HasPrefix(s, "978") || strings.HasPrefix(s, "979")) && s[12] == isbn13Check(s)
+}
+
+func ValidISBN(s string) bool { return ValidISBN10(s) || ValidISBN13(s) }
+
+// NormalizeISBN strips hyphens and spaces and validates the checksum
+func NormalizeISBN(s string) (string, error) {
+	if !ValidISBN(s) { return "", ErrInvalidISBN }
+	return CleanISBN(s), nil
+}
+
+// ISBN10To13 converts an ISBN-10 to the 978 prefixed ISBN-13
+func ISBN10To13(s string) (string, error) {
+	if !ValidISBN10(s) { return "", ErrInvalidISBN }
+	s = "978" + CleanISBN(s)[:9]
+	return s + string(isbn13Check(s)), nil
+}
+
+// ISBN13To10 converts a 978 prefixed ISBN-13, 979 ISBNs have no ISBN-10
+func ISBN13To10(s string) (string, error) {
+	if !ValidISBN13(s) { return "", ErrInvalidISBN }
+	s = CleanISBN(s)
+	if !strings.HasPrefix(s, "978") { return "", errors.New("ISBN-13 with prefix 979 has no ISBN-10") }
+	s = s[3:12]
+	return s + string(isbn10Check(s)), nil
+}
+
+// ToISBN13 normalises an ISBN-10 or ISBN-13 to ISBN-13
+func ToISBN13(s string) (string, error) {
+	if ValidISBN10(s) { return ISBN10To13(s) }
+	return NormalizeISBN(s)
+}
+
+// NormalizeISSN validates an ISSN and formats it as 1234-567X
+func NormalizeISSN(s string) (string, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimLeft(strings.TrimPrefix(s, "ISSN"), ": ")
+	s = strings.NewReplacer("-", "", " ", "").Replace(s)
+	if len(s) != 8 || !digits(s, true) { return "", ErrInvalidISSN }
+	sum := 0
+	for i := 0; i < 7; i++ { sum += int(s[i] - '0') * (8 - i) }
+	c := (11 - sum % 11) % 11
+	check := byte('0' + c)
+	if c == 10 { check = 'X' }
+	if s[7] != check { return "", ErrInvalidISSN }
+	return s[:4] + "-" + s[4:], nil
+}
+
+func ValidISSN(s string) bool {
+	_, err := NormalizeISSN(s)
+	return err == nil
+}
+
+var doiPrefixes = []string{"https://doi.org/", "http://doi.org/", "https://dx.doi.org/", "http://dx.doi.org/", "doi:"}
+
+// NormalizeDOI strips resolver URLs and the doi: scheme and lowercases the
+// DOI, which is case insensitive. A DOI starts with the 10. directory.
+func NormalizeDOI(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	for _, prefix := range doiPrefixes {
+		if strings.HasPrefix(strings.ToLower(s), prefix) { s = s[len(prefix):] }
+	}
+	s = strings.ToLower(strings.TrimSpace(s))
+	slash := strings.Index(s, "/")
+	if !strings.HasPrefix(s, "10.") || slash < 4 || slash == len(s) - 1 || strings.ContainsAny(s, " \t") {
+		return "", ErrInvalidDOI
+	}
+	return s, nil
+}
+
+func ValidDOI(s string) bool {
+	_, err := NormalizeDOI(s)
+	return err == nil
+}
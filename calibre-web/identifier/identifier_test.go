@@ -0,0 +1,124 @@
+package identifier
+
+import "testing"
+
+func TestCleanISBN(t *testing.T) {
+	tests := map[string]string{
+		"978-0-261-10235-4": "9780261102354",
+		" 0 261 10235 4 ": "0261102354",
+		"isbn 0261102354": "0261102354",
+		"ISBN: 0-261-10235-4": "0261102354",
+		"ISBN-13: 978-0-261-10235-4": "9780261102354",
+		"ISBN-10: 0-261-10235-4": "0261102354",
+		"ISBN13: 9780261102354": "9780261102354",
+		"ISBN 13: 9780261102354": "9780261102354",
+		"ISBN-10 0261102354": "0261102354",
+		"ISBN 1386102354": "1386102354",
+		"978‐0‐261‐10235‐4": "9780261102354",
+	}
+	for in, want := range tests {
+		if got := CleanISBN(in); got != want { t.Errorf("CleanISBN(%q) = %q, want %q", in, got, want) }
+	}
+}
+
+func TestValidISBN(t *testing.T) {
+	tests := []struct {
+		in string
+		isbn10, isbn13 bool
+	}{
+		{"0261102354", true, false},
+		{"0-8044-2957-X", true, false},
+		{"080442957x", true, false},
+		{"0261102355", false, false},
+		{"X261102354", false, false},
+		{"9780261102354", false, true},
+		{"ISBN-13: 978-0-261-10235-4", false, true},
+		{"9791032305690", false, true},
+		{"9780261102355", false, false},
+		// Valid checksum without the 978 or 979 prefix
+		{"9770261102359", false, false},
+		{"978026110235X", false, false},
+		{"", false, false},
+	}
+	for _, test := range tests {
+		if got := ValidISBN10(test.in); got != test.isbn10 { t.Errorf("ValidISBN10(%q) = %v", test.in, got) }
+		if got := ValidISBN13(test.in); got != test.isbn13 { t.Errorf("ValidISBN13(%q) = %v", test.in, got) }
+		if got := ValidISBN(test.in); got != (test.isbn10 || test.isbn13) { t.Errorf("ValidISBN(%q) = %v", test.in, got) }
+	}
+}
+
+func TestNormalizeISBN(t *testing.T) {
+	got, err := NormalizeISBN("ISBN 978-0-261-10235-4")
+	if err != nil || got != "9780261102354" { t.Errorf("NormalizeISBN = %q, %v", got, err) }
+	got, err = NormalizeISBN("0-8044-2957-x")
+	if err != nil || got != "080442957X" { t.Errorf("NormalizeISBN = %q, %v", got, err) }
+	_, err = NormalizeISBN("978-0-261-10235-5")
+	if err != ErrInvalidISBN { t.Errorf("NormalizeISBN of a bad checksum: %v", err) }
+}
+
+func TestISBNConversion(t *testing.T) {
+	pairs := []struct{ isbn10, isbn13 string }{
+		{"0261102354", "9780261102354"},
+		{"080442957X", "9780804429573"},
+		{"0306406152", "9780306406157"},
+	}
+	for _, p := range pairs {
+		if got, err := ISBN10To13(p.isbn10); err != nil || got != p.isbn13 { t.Errorf("ISBN10To13(%q) = %q, %v", p.isbn10, got, err) }
+		if got, err := ISBN13To10(p.isbn13); err != nil || got != p.isbn10 { t.Errorf("ISBN13To10(%q) = %q, %v", p.isbn13, got, err) }
+		if got, err := ToISBN13(p.isbn10); err != nil || got != p.isbn13 { t.Errorf("ToISBN13(%q) = %q, %v", p.isbn10, got, err) }
+		if got, err := ToISBN13(p.isbn13); err != nil || got != p.isbn13 { t.Errorf("ToISBN13(%q) = %q, %v", p.isbn13, got, err) }
+	}
+
+	if _, err := ISBN13To10("9791032305690"); err == nil { t.Error("ISBN13To10 converted a 979 ISBN") }
+	if _, err := ISBN10To13("0261102355"); err != ErrInvalidISBN { t.Errorf("ISBN10To13 of a bad checksum: %v", err) }
+	if _, err := ISBN13To10("0261102354"); err != ErrInvalidISBN { t.Errorf("ISBN13To10 of an ISBN-10: %v", err) }
+	if _, err := ToISBN13("12345"); err != ErrInvalidISBN { t.Errorf("ToISBN13 of garbage: %v", err) }
+}
+
+func TestNormalizeISSN(t *testing.T) {
+	tests := map[string]string{
+		"0378-5955": "0378-5955",
+		"03785955": "0378-5955",
+		"ISSN 0378-5955": "0378-5955",
+		"issn: 2434-561x": "2434-561X",
+		"0317-8471": "0317-8471",
+		"0378-5954": "",
+		"0378-595": "",
+		"X378-5955": "",
+	}
+	for in, want := range tests {
+		got, err := NormalizeISSN(in)
+		if want == "" {
+			if err != ErrInvalidISSN { t.Errorf("NormalizeISSN(%q) = %q, %v, want invalid", in, got, err) }
+			continue
+		}
+		if err != nil || got != want { t.Errorf("NormalizeISSN(%q) = %q, %v, want %q", in, got, err, want) }
+		if !ValidISSN(in) { t.Errorf("ValidISSN(%q) = false", in) }
+	}
+}
+
+func TestNormalizeDOI(t *testing.T) {
+	tests := map[string]string{
+		"10.1000/182": "10.1000/182",
+		"10.1000/ABC.def": "10.1000/abc.def",
+		"doi:10.1000/182": "10.1000/182",
+		"https://doi.org/10.1000/182": "10.1000/182",
+		"http://dx.doi.org/10.1002/(SICI)1097-4571": "10.1002/(sici)1097-4571",
+		" 10.1038/nphys1170 ": "10.1038/nphys1170",
+		"10.1000": "",
+		"10.1000/": "",
+		"11.1000/182": "",
+		"10./182": "",
+		"10.1000/18 2": "",
+		"": "",
+	}
+	for in, want := range tests {
+		got, err := NormalizeDOI(in)
+		if want == "" {
+			if err != ErrInvalidDOI { t.Errorf("NormalizeDOI(%q) = %q, %v, want invalid", in, got, err) }
+			if ValidDOI(in) { t.Errorf("ValidDOI(%q) = true", in) }
+			continue
+		}
+		if err != nil || got != want { t.Errorf("NormalizeDOI(%q) = %q, %v, want %q", in, got, err, want) }
+	}
+}
@@ -0,0 +1,321 @@
+// Package kobo acts as a Kobo device against the Kobo sync endpoint of
+// calibre-web, which lives below /kobo/<auth token>. The auth token is
+// generated on the calibre-web profile page.
+package kobo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// UserAgent is the user agent of the firmware calibre-web was tested with
+const UserAgent = "Mozilla/5.0 (Linux; U; Android 2.0; en-us;) AppleWebKit/538.1 (KHTML, like Gecko) Version/4.0 Mobile Safari/538.1 (Kobo Touch 0377/4.20.14622)"
+
+const (
+	StatusReadyToRead = "ReadyToRead"
+	StatusReading = "Reading"
+	StatusFinished = "Finished"
+)
+
+// Timestamp formats t the way Kobo devices do
+func Timestamp(t time.Time) string { return t.UTC().Format("2006-01-02T15:04:05Z") }
+
+type DownloadURL struct {
+	Format string `json:"Format"`
+	Size int64 `json:"Size"`
+	URL string `json:"Url"`
+	Platform string `json:"Platform"`
+}
+
+type Series struct {
+	Name string `json:"Name"`
+	Number string `json:"Number"`
+	NumberFloat float64 `json:"NumberFloat"`
+	ID string `json:"Id"`
+}
+
+type BookMetadata struct {
+	EntitlementID string `json:"EntitlementId"`
+	RevisionID string `json:"RevisionId"`
+	CrossRevisionID string `json:"CrossRevisionId"`
+	Title string `json:"Title"`
+	Description string `json:"Description,omitempty"`
+	Contributors []string `json:"Contributors"`
+	Language string `json:"Language"`
+	PublicationDate string `json:"PublicationDate,omitempty"`
+	Publisher struct {
+		Name string `json:"Name"`
+		Imprint string `json:"Imprint"`
+	} `json:"Publisher"`
+	Series *Series `json:"Series,omitempty"`
+	CoverImageID string `json:"CoverImageId"`
+	DownloadURLs []DownloadURL `json:"DownloadUrls"`
+}
+
+type BookEntitlement struct {
+	ID string `json:"Id"`
+	RevisionID string `json:"RevisionId"`
+	Created string `json:"Created"`
+	LastModified string `json:"LastModified"`
+	IsRemoved bool `json:"IsRemoved"`
+	IsHiddenFromArchive bool `json:"IsHiddenFromArchive"`
+	IsLocked bool `json:"IsLocked"`
+	Status string `json:"Status"`
+}
+
+type Location struct {
+	Value string `json:"Value"`
+	Type string `json:"Type"`
+	Source string `json:"Source"`
+}
+
+type Bookmark struct {
+	LastModified string `json:"LastModified"`
+	ProgressPercent float64 `json:"ProgressPercent,omitempty"`
+	ContentSourceProgressPercent float64 `json:"ContentSourceProgressPercent,omitempty"`
+	Location *Location `json:"Location,omitempty"`
+}
+
+type StatusInfo struct {
+	LastModified string `json:"LastModified"`
+	Status string `json:"Status"`
+	TimesStartedReading int `json:"TimesStartedReading"`
+	LastTimeStartedReading string `json:"LastTimeStartedReading,omitempty"`
+}
+
+type Statistics struct {
+	LastModified string `json:"LastModified"`
+	SpentReadingMinutes int `json:"SpentReadingMinutes,omitempty"`
+	RemainingTimeMinutes int `json:"RemainingTimeMinutes,omitempty"`
+}
+
+type ReadingState struct {
+	EntitlementID string `json:"EntitlementId"`
+	Created string `json:"Created,omitempty"`
+	LastModified string `json:"LastModified"`
+	PriorityTimestamp string `json:"PriorityTimestamp,omitempty"`
+	StatusInfo StatusInfo `json:"StatusInfo"`
+	Statistics Statistics `json:"Statistics"`
+	CurrentBookmark Bookmark `json:"CurrentBookmark"`
+}
+
+// Touch sets all modification times of the state to t, calibre-web
+// only applies the parts that are newer than what it has
+func (rs *ReadingState) Touch(t time.Time) {
+	ts := Timestamp(t)
+	rs.LastModified, rs.PriorityTimestamp = ts, ts
+	rs.StatusInfo.LastModified = ts
+	rs.Statistics.LastModified = ts
+	rs.CurrentBookmark.LastModified = ts
+}
+
+// Entitlement is a book in the library of the device
+type Entitlement struct {
+	BookEntitlement BookEntitlement `json:"BookEntitlement"`
+	BookMetadata *BookMetadata `json:"BookMetadata"`
+	ReadingState *ReadingState `json:"ReadingState"`
+}
+
+// Change is an item of a library sync. Kind is the key of the item, like
+// NewEntitlement, ChangedEntitlement or ChangedReadingState.
+type Change struct {
+	Kind string
+	Entitlement *Entitlement
+	// ReadingState is only set for ChangedReadingState
+	ReadingState *ReadingState
+	// Raw is the item for kinds not parsed, like tags
+	Raw json.RawMessage
+}
+
+// Client is a Kobo device. SyncToken is the state of the library sync, a
+// device that keeps it only receives changes on the next sync.
+type Client struct {
+	base string
+	c *http.Client
+	SyncToken string
+}
+
+// NewClient creates a device for the calibre-web server at serverURL, a nil c uses http.DefaultClient
+func NewClient(serverURL, token string, c *http.Client) *Client {
+	if c == nil { c = http.DefaultClient }
+	return &Client{base: strings.TrimSuffix(serverURL, "/") + "/kobo/" + url.PathEscape(token), c: c}
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil { return nil, err }
+		r = bytes.NewReader(b)
+	}
+	u := path
+	if !strings.HasPrefix(path, "http") { u = c.base + path }
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil { return nil, err }
+	req.Header.Set("User-Agent", UserAgent)
+	if body != nil { req.Header.Set("Content-Type", "application/json") }
+	return req, nil
+}
+
+// send returns an error for responses that are not 2xx
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	resp, err := c.c.Do(req)
+	if err != nil { return nil, err }
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("kobo: %s %s: %s", req.Method, strings.TrimPrefix(req.URL.String(), c.base), resp.Status)
+	}
+	return resp, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, path, body)
+	if err != nil { return nil, err }
+	return c.send(req)
+}
+
+func (c *Client) decode(ctx context.Context, method, path string, body, v interface{}) error {
+	resp, err := c.do(ctx, method, path, body)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Initialize requests the resources a device loads on start, which are the
+// URLs of the store services calibre-web replaces
+func (c *Client) Initialize(ctx context.Context) (map[string]interface{}, error) {
+	var init struct {
+		Resources map[string]interface{} `json:"Resources"`
+	}
+	err := c.decode(ctx, http.MethodGet, "/v1/initialization", nil, &init)
+	if err != nil { return nil, err }
+	return init.Resources, nil
+}
+
+// Sync requests one batch of library changes. The second return value is
+// true if calibre-web has more changes.
+func (c *Client) Sync(ctx context.Context) ([]*Change, bool, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/v1/library/sync", nil)
+	if err != nil { return nil, false, err }
+	if c.SyncToken != "" { req.Header.Set("x-kobo-synctoken", c.SyncToken) }
+	resp, err := c.send(req)
+	if err != nil { return nil, false, err }
+	defer resp.Body.Close()
+
+	items := []map[string]json.RawMessage{}
+	err = json.NewDecoder(resp.Body).Decode(&items)
+	if err != nil { return nil, false, err }
+
+	changes := []*Change{}
+	for _, item := range items {
+		for kind, raw := range item {
+			change := &Change{Kind: kind, Raw: raw}
+			switch kind {
+			case "NewEntitlement", "ChangedEntitlement":
+				change.Entitlement = new(Entitlement)
+				err = json.Unmarshal(raw, change.Entitlement)
+			case "ChangedReadingState":
+				var state struct {
+					ReadingState *ReadingState `json:"ReadingState"`
+				}
+				err = json.Unmarshal(raw, &state)
+				change.ReadingState = state.ReadingState
+			}
+			if err != nil { return nil, false, fmt.Errorf("kobo: sync: %s: %w", kind, err) }
+			changes = append(changes, change)
+		}
+	}
+
+	if token := resp.Header.Get("x-kobo-synctoken"); token != "" { c.SyncToken = token }
+	return changes, resp.Header.Get("x-kobo-sync") == "continue", nil
+}
+
+// SyncAll syncs until calibre-web has no more changes
+func (c *Client) SyncAll(ctx context.Context) ([]*Change, error) {
+	all := []*Change{}
+	for {
+		changes, more, err := c.Sync(ctx)
+		if err != nil { return nil, err }
+		all = append(all, changes...)
+		if !more { return all, nil }
+	}
+}
+
+// ReadingStates returns the reading states of changes with one state per
+// book, the one modified last. A sync reports a book again for every change.
+func ReadingStates(changes []*Change) []*ReadingState {
+	states := []*ReadingState{}
+	index := map[string]int{}
+	for _, change := range changes {
+		state := change.ReadingState
+		if change.Entitlement != nil && change.Entitlement.ReadingState != nil { state = change.Entitlement.ReadingState }
+		if state == nil { continue }
+		i, ok := index[state.EntitlementID]
+		if !ok {
+			index[state.EntitlementID] = len(states)
+			states = append(states, state)
+			continue
+		}
+		if !newer(states[i].LastModified, state.LastModified) { states[i] = state }
+	}
+	return states
+}
+
+// newer reports whether timestamp a is after b, unparsable timestamps are
+// compared as strings
+func newer(a, b string) bool {
+	ta, erra := time.Parse(time.RFC3339Nano, a)
+	tb, errb := time.Parse(time.RFC3339Nano, b)
+	if erra != nil || errb != nil { return a > b }
+	return ta.After(tb)
+}
+
+// Metadata loads the metadata of a book by its uuid
+func (c *Client) Metadata(ctx context.Context, uuid string) (*BookMetadata, error) {
+	list := []*BookMetadata{}
+	err := c.decode(ctx, http.MethodGet, "/v1/library/" + url.PathEscape(uuid) + "/metadata", nil, &list)
+	if err != nil { return nil, err }
+	if len(list) == 0 { return nil, fmt.Errorf("kobo: no metadata for %s", uuid) }
+	return list[0], nil
+}
+
+// ReadingState loads the reading state of a book by its uuid
+func (c *Client) ReadingState(ctx context.Context, uuid string) (*ReadingState, error) {
+	list := []*ReadingState{}
+	err := c.decode(ctx, http.MethodGet, "/v1/library/" + url.PathEscape(uuid) + "/state", nil, &list)
+	if err != nil { return nil, err }
+	if len(list) == 0 { return nil, fmt.Errorf("kobo: no reading state for %s", uuid) }
+	return list[0], nil
+}
+
+// UpdateReadingState uploads a reading state. Use Touch to make sure it
+// is newer than the state calibre-web has.
+func (c *Client) UpdateReadingState(ctx context.Context, state *ReadingState) error {
+	var result struct {
+		RequestResult string `json:"RequestResult"`
+	}
+	body := map[string][]*ReadingState{"ReadingStates": {state}}
+	err := c.decode(ctx, http.MethodPut, "/v1/library/" + url.PathEscape(state.EntitlementID) + "/state", body, &result)
+	if err != nil { return err }
+	if result.RequestResult != "Success" { return fmt.Errorf("kobo: updating reading state: %s", result.RequestResult) }
+	return nil
+}
+
+// Archive removes a book from the device, calibre-web marks it archived
+func (c *Client) Archive(ctx context.Context, uuid string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/v1/library/" + url.PathEscape(uuid), nil)
+	if err != nil { return err }
+	return resp.Body.Close()
+}
+
+// Download opens a download URL of BookMetadata
+func (c *Client) Download(ctx context.Context, d DownloadURL) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, d.URL, nil)
+}
@@ -0,0 +1,65 @@
+package kobo
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	tokens := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/kobo/secret/v1/library/sync" || r.UserAgent() != UserAgent {
+			http.Error(w, "unexpected request", http.StatusForbidden)
+			return
+		}
+		token := r.Header.Get("x-kobo-synctoken")
+		tokens = append(tokens, token)
+		w.Header().Set("x-kobo-synctoken", fmt.Sprintf("token%d", len(tokens)))
+		if token == "" {
+			w.Header().Set("x-kobo-sync", "continue")
+			fmt.Fprint(w, `[{"NewEntitlement": {"BookEntitlement": {"Id": "a"}, "BookMetadata": {"Title": "Mort"}, "ReadingState": {"EntitlementId": "a", "LastModified": "2021-01-01T00:00:00Z"}}}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"ChangedReadingState": {"ReadingState": {"EntitlementId": "a", "LastModified": "2021-02-01T00:00:00Z"}}}, {"ChangedTag": {"Tag": {}}}]`)
+	}))
+	defer server.Close()
+
+	device := NewClient(server.URL + "/", "secret", nil)
+	changes, err := device.SyncAll(context.Background())
+	if err != nil { t.Fatal(err) }
+	if strings.Join(tokens, ",") != ",token1" { t.Errorf("sent tokens %q", tokens) }
+	if device.SyncToken != "token2" { t.Errorf("kept token %q", device.SyncToken) }
+	if len(changes) != 3 || changes[0].Entitlement.BookMetadata.Title != "Mort" || changes[1].ReadingState == nil || changes[2].Kind != "ChangedTag" {
+		t.Errorf("got changes %+v", changes)
+	}
+
+	states := ReadingStates(changes)
+	if len(states) != 1 || states[0].LastModified != "2021-02-01T00:00:00Z" { t.Errorf("got states %+v", states) }
+
+	_, _, err = NewClient(server.URL, "wrong", nil).Sync(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "403") { t.Errorf("got error %v", err) }
+}
+
+func TestReadingStates(t *testing.T) {
+	state := func(id, modified string) *Change {
+		return &Change{Kind: "ChangedReadingState", ReadingState: &ReadingState{EntitlementID: id, LastModified: modified}}
+	}
+	changes := []*Change{
+		state("a", "2021-03-01T00:00:00Z"),
+		state("b", "2021-01-01T00:00:00Z"),
+		state("a", "2021-02-01T00:00:00Z"),
+		{Kind: "ChangedEntitlement", Entitlement: &Entitlement{ReadingState: &ReadingState{EntitlementID: "b", LastModified: "2021-01-02T00:00:00.5Z"}}},
+		{Kind: "ChangedTag"},
+		state("c", "invalid"),
+		state("c", "later invalid"),
+	}
+
+	got := []string{}
+	for _, s := range ReadingStates(changes) { got = append(got, s.EntitlementID + " " + s.LastModified) }
+	want := []string{"a 2021-03-01T00:00:00Z", "b 2021-01-02T00:00:00.5Z", "c later invalid"}
+	if strings.Join(got, ",") != strings.Join(want, ",") { t.Errorf("got %q, want %q", got, want) }
+}
@@ -0,0 +1,216 @@
+// Package library reads a Calibre library mirrored to disk, a directory
+// per book with the book files, cover.jpg and a metadata.opf
+package library
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yrhki/gocalibre/calibre-web/format"
+)
+
+type Book struct {
+	// ID is the calibre book id from the OPF or the directory name
+	ID uint64
+	Dir string
+
+	Title string
+	Authors []string
+	Tags []string
+	Publisher string
+	Description string
+	Series string
+	SeriesIndex float64
+	Languages []string
+	Published *time.Time
+	Identifiers map[string]string
+
+	// Files are the paths of the book formats
+	Files map[format.Format]string
+	// Cover is the path of the cover image or empty
+	Cover string
+	// Modified is the modification time of metadata.opf
+	Modified time.Time
+}
+
+type opfMeta struct {
+	Name string `xml:"name,attr"`
+	Content string `xml:"content,attr"`
+}
+
+type opfElement struct {
+	Attrs []xml.Attr `xml:",any,attr"`
+	Value string `xml:",chardata"`
+}
+
+// attr returns an attribute by local name, OPF 2 uses opf:scheme and opf:role
+func (e opfElement) attr(name string) string {
+	for _, a := range e.Attrs {
+		if strings.EqualFold(a.Name.Local, name) { return a.Value }
+	}
+	return ""
+}
+
+type opfPackage struct {
+	Metadata struct {
+		Titles []string `xml:"title"`
+		Creators []opfElement `xml:"creator"`
+		Subjects []string `xml:"subject"`
+		Publisher string `xml:"publisher"`
+		Description string `xml:"description"`
+		Languages []string `xml:"language"`
+		Date string `xml:"date"`
+		Identifiers []opfElement `xml:"identifier"`
+		Meta []opfMeta `xml:"meta"`
+	} `xml:"metadata"`
+	Guide []struct {
+		Type string `xml:"type,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"guide>reference"`
+}
+
+// dirID matches the " (123)" suffix calibre adds to book directories
+var dirID = regexp.MustCompile(`\((\d+)\)$`)
+
+// ReadBook reads the metadata.opf of a book directory and finds its files
+func ReadBook(dir string) (*Book, error) {
+	opfPath := filepath.Join(dir, "metadata.opf")
+	file, err := os.Open(opfPath)
+	if err != nil { return nil, err }
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil { return nil, err }
+
+	opf := new(opfPackage)
+	err = xml.NewDecoder(file).Decode(opf)
+	if err != nil { return nil, err }
+	m := opf.Metadata
+
+	book := &Book{
+		Dir: dir,
+		Authors: []string{},
+		Tags: m.Subjects,
+		Publisher: strings.TrimSpace(m.Publisher),
+		Description: strings.TrimSpace(m.Description),
+		Languages: m.Languages,
+		Identifiers: map[string]string{},
+		Files: map[format.Format]string{},
+		Modified: stat.ModTime(),
+	}
+	if len(m.Titles) > 0 { book.Title = strings.TrimSpace(m.Titles[0]) }
+	for _, c := range m.Creators {
+		if role := c.attr("role"); role == "" || role == "aut" { book.Authors = append(book.Authors, strings.TrimSpace(c.Value)) }
+	}
+	if t, err := time.Parse(time.RFC3339, strings.TrimSpace(m.Date)); err == nil && t.Year() > 101 { book.Published = &t }
+
+	for _, meta := range m.Meta {
+		switch meta.Name {
+		case "calibre:series":
+			book.Series = meta.Content
+		case "calibre:series_index":
+			book.SeriesIndex, _ = strconv.ParseFloat(meta.Content, 64)
+		}
+	}
+
+	for _, identifier := range m.Identifiers {
+		scheme := strings.ToLower(identifier.attr("scheme"))
+		value := strings.TrimSpace(identifier.Value)
+		switch scheme {
+		case "":
+		case "calibre":
+			book.ID, _ = strconv.ParseUint(value, 10, 64)
+		default:
+			book.Identifiers[scheme] = value
+		}
+	}
+	if match := dirID.FindStringSubmatch(filepath.Base(dir)); book.ID == 0 && match != nil {
+		book.ID, _ = strconv.ParseUint(match[1], 10, 64)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil { return nil, err }
+	for _, e := range entries {
+		if e.IsDir() { continue }
+		if f, ok := format.FromExt(filepath.Ext(e.Name())); ok { book.Files[f] = filepath.Join(dir, e.Name()) }
+	}
+	for _, ref := range opf.Guide {
+		if ref.Type != "cover" { continue }
+		cover, ok := inDir(dir, ref.Href)
+		if !ok { return nil, fmt.Errorf("%s: cover %q is outside the book directory", opfPath, ref.Href) }
+		book.Cover = cover
+	}
+	if book.Cover == "" {
+		if _, err := os.Stat(filepath.Join(dir, "cover.jpg")); err == nil { book.Cover = filepath.Join(dir, "cover.jpg") }
+	}
+	return book, nil
+}
+
+// inDir joins a relative href to dir, ok is false if the result is not inside dir
+func inDir(dir, href string) (string, bool) {
+	if path.IsAbs(href) || filepath.IsAbs(href) || filepath.VolumeName(href) != "" { return "", false }
+	p := filepath.Join(dir, filepath.FromSlash(href))
+	rel, err := filepath.Rel(dir, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".." + string(filepath.Separator)) { return "", false }
+	return p, true
+}
+
+// Library is the books found below a directory
+type Library struct {
+	Dir string
+	// Books are sorted by title
+	Books []*Book
+	// Skipped are the errors of book directories that could not be read
+	Skipped []error
+	byID map[uint64]*Book
+}
+
+// Open reads every book directory below dir. Books without a calibre id
+// get ids above the highest id found. Books that can't be read are skipped
+// and their errors kept in Skipped.
+func Open(dir string) (*Library, error) {
+	lib := &Library{Dir: dir, Books: []*Book{}, byID: map[uint64]*Book{}}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil { return err }
+		if info.IsDir() || info.Name() != "metadata.opf" { return nil }
+		// calibre keeps a backup of the library metadata in the root
+		if filepath.Dir(p) == filepath.Clean(dir) { return nil }
+		book, err := ReadBook(filepath.Dir(p))
+		if err != nil {
+			lib.Skipped = append(lib.Skipped, err)
+			return nil
+		}
+		lib.Books = append(lib.Books, book)
+		return nil
+	})
+	if err != nil { return nil, err }
+	if len(lib.Books) == 0 && len(lib.Skipped) > 0 { return nil, fmt.Errorf("library: no book could be read, first error: %w", lib.Skipped[0]) }
+	if len(lib.Books) == 0 { return nil, errors.New("library: no metadata.opf found in " + dir) }
+
+	var max uint64
+	for _, book := range lib.Books {
+		if book.ID > max { max = book.ID }
+	}
+	for _, book := range lib.Books {
+		if book.ID == 0 || lib.byID[book.ID] != nil {
+			max++
+			book.ID = max
+		}
+		lib.byID[book.ID] = book
+	}
+	sort.Slice(lib.Books, func(i, j int) bool { return strings.ToLower(lib.Books[i].Title) < strings.ToLower(lib.Books[j].Title) })
+	return lib, nil
+}
+
+func (lib *Library) Book(id uint64) (*Book, bool) {
+	book, ok := lib.byID[id]
+	return book, ok
+}
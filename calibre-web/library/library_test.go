@@ -0,0 +1,123 @@
+package library
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yrhki/gocalibre/calibre-web/opds"
+)
+
+const testOPF = `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+<dc:identifier opf:scheme="calibre">%d</dc:identifier>
+<dc:title>%s</dc:title>
+<dc:creator opf:role="aut">Terry Pratchett</dc:creator>
+<meta name="calibre:series" content="Discworld"/>
+</metadata>
+<guide><reference type="cover" title="Cover" href="%s"/></guide>
+</package>`
+
+// writeBook creates a book directory below dir with a metadata.opf
+func writeBook(t *testing.T, dir, name, opf string) string {
+	bookDir := filepath.Join(dir, "Terry Pratchett", name)
+	if err := os.MkdirAll(bookDir, 0755); err != nil { t.Fatal(err) }
+	if err := ioutil.WriteFile(filepath.Join(bookDir, "metadata.opf"), []byte(opf), 0644); err != nil { t.Fatal(err) }
+	return bookDir
+}
+
+func TestOpenSkipsBadBooks(t *testing.T) {
+	dir := t.TempDir()
+	writeBook(t, dir, "Mort (1)", fmt.Sprintf(testOPF, 1, "Mort", "cover.jpg"))
+	writeBook(t, dir, "Broken (2)", "<package><metadata>")
+	writeBook(t, dir, "Escape (3)", fmt.Sprintf(testOPF, 3, "Escape", "../../../secret.txt"))
+	writeBook(t, dir, "Absolute (4)", fmt.Sprintf(testOPF, 4, "Absolute", "/etc/passwd"))
+
+	lib, err := Open(dir)
+	if err != nil { t.Fatal(err) }
+	if len(lib.Books) != 1 || lib.Books[0].Title != "Mort" { t.Errorf("books %v, want only Mort", lib.Books) }
+	if len(lib.Skipped) != 3 { t.Errorf("skipped %v, want 3 errors", lib.Skipped) }
+	if want := filepath.Join(dir, "Terry Pratchett", "Mort (1)", "cover.jpg"); lib.Books[0].Cover != want { t.Errorf("cover %q, want %q", lib.Books[0].Cover, want) }
+
+	empty := t.TempDir()
+	writeBook(t, empty, "Broken (1)", "<package><metadata>")
+	if _, err := Open(empty); err == nil { t.Error("library without readable books was opened") }
+}
+
+func TestInDir(t *testing.T) {
+	dir := filepath.FromSlash("/lib/book")
+	tests := map[string]bool{
+		"cover.jpg": true,
+		"images/cover.jpg": true,
+		"images/../cover.jpg": true,
+		"..cover.jpg": true,
+		"../cover.jpg": false,
+		"images/../../cover.jpg": false,
+		"..": false,
+		"/etc/passwd": false,
+	}
+	for href, want := range tests {
+		if _, ok := inDir(dir, href); ok != want { t.Errorf("inDir(%q) = %v, want %v", href, ok, want) }
+	}
+}
+
+func TestNavigationTypes(t *testing.T) {
+	dir := t.TempDir()
+	writeBook(t, dir, "Mort (1)", fmt.Sprintf(testOPF, 1, "Mort", "cover.jpg"))
+	lib, err := Open(dir)
+	if err != nil { t.Fatal(err) }
+	server := NewServer(lib, "Test")
+
+	feedOf := func(path string) *opds.Feed {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		feed, err := opds.Parse(w.Body, nil)
+		if err != nil { t.Fatalf("%s: %v", path, err) }
+		return feed
+	}
+
+	kinds := map[string]string{}
+	for _, e := range feedOf("/opds").Entries { kinds[e.Links[0].Href] = e.Links[0].Type }
+	for href, kind := range map[string]string{"/opds/books": "acquisition", "/opds/new": "acquisition", "/opds/author": "navigation", "/opds/series": "navigation"} {
+		if !strings.HasSuffix(kinds[href], "kind=" + kind) { t.Errorf("%s linked as %q, want %s", href, kinds[href], kind) }
+	}
+	for _, index := range []string{"/opds/author", "/opds/series"} {
+		for _, e := range feedOf(index).Entries {
+			if !strings.HasSuffix(e.Links[0].Type, "kind=acquisition") { t.Errorf("%s: %s linked as %q", index, e.Links[0].Href, e.Links[0].Type) }
+		}
+	}
+}
+
+func TestIndexNamesWithSlash(t *testing.T) {
+	dir := t.TempDir()
+	writeBook(t, dir, "Mort (1)", strings.Replace(fmt.Sprintf(testOPF, 1, "Mort", "cover.jpg"), "Terry Pratchett", "AC/DC", 1))
+	lib, err := Open(dir)
+	if err != nil { t.Fatal(err) }
+	server := NewServer(lib, "Test")
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/opds/author", nil))
+	feed, err := opds.Parse(w.Body, nil)
+	if err != nil { t.Fatal(err) }
+	if len(feed.Entries) != 1 { t.Fatalf("authors %v", feed.Entries) }
+	href := feed.Entries[0].Links[0].Href
+	if href != "/opds/author/AC%2FDC" { t.Errorf("linked as %q", href) }
+
+	for path, want := range map[string]int{href: 1, "/opds/author/AC%2FDC/": 1, "/opds/author/AC/DC": 0, "/opds/series/Discworld": 1} {
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if want == 0 {
+			if w.Code != http.StatusNotFound { t.Errorf("%s: status %d", path, w.Code) }
+			continue
+		}
+		feed, err = opds.Parse(w.Body, nil)
+		if err != nil { t.Fatalf("%s: %v", path, err) }
+		if len(feed.Entries) != want { t.Errorf("%s: %d books", path, len(feed.Entries)) }
+	}
+}
@@ -0,0 +1,284 @@
+package library
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yrhki/gocalibre/calibre-web/format"
+	"github.com/yrhki/gocalibre/calibre-web/opds"
+)
+
+const (
+	typeNavigation = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	typeAcquisition = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+)
+
+// Server publishes a Library as an OPDS 1.2 catalog below /opds, with
+// the same paths calibre-web uses so the opds client works with both
+type Server struct {
+	Library *Library
+	Title string
+	// PageSize is the number of books per page, 30 if 0
+	PageSize int
+}
+
+func NewServer(lib *Library, title string) *Server { return &Server{Library: lib, Title: title} }
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case p == "" || p == "/opds":
+		s.root(w, r)
+	case p == "/opds/books":
+		s.books(w, r, "books", "All books", s.Library.Books)
+	case p == "/opds/new":
+		books := append([]*Book{}, s.Library.Books...)
+		sort.SliceStable(books, func(i, j int) bool { return books[i].Modified.After(books[j].Modified) })
+		s.books(w, r, "new", "Recently added", books)
+	case p == "/opds/author" || p == "/opds/series":
+		s.index(w, r, path.Base(p))
+	case strings.HasPrefix(p, "/opds/author/") || strings.HasPrefix(p, "/opds/series/"):
+		// Names are escaped, a "/" in them is only kept apart in the escaped path
+		kind := strings.SplitN(strings.TrimPrefix(p, "/opds/"), "/", 2)[0]
+		escaped := strings.TrimPrefix(strings.TrimSuffix(r.URL.EscapedPath(), "/"), "/opds/" + kind + "/")
+		name, err := url.PathUnescape(escaped)
+		if err != nil || strings.Contains(escaped, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		s.indexBooks(w, r, kind, name)
+	case p == "/opds/osd":
+		s.osd(w, r)
+	case p == "/opds/search" || strings.HasPrefix(p, "/opds/search/"):
+		query := r.URL.Query().Get("query")
+		if strings.HasPrefix(p, "/opds/search/") { query = strings.TrimPrefix(p, "/opds/search/") }
+		s.books(w, r, "search", "Search: " + query, s.search(query))
+	case strings.HasPrefix(p, "/opds/download/"):
+		s.download(w, r, strings.Split(strings.TrimPrefix(p, "/opds/download/"), "/"))
+	case strings.HasPrefix(p, "/opds/cover/"):
+		s.cover(w, r, strings.TrimPrefix(p, "/opds/cover/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) updated() string {
+	var t time.Time
+	for _, book := range s.Library.Books {
+		if book.Modified.After(t) { t = book.Modified }
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func (s *Server) feed(id, title string) *opds.Feed {
+	return &opds.Feed{
+		ID: "urn:calibrecli:" + id,
+		Title: title,
+		Updated: s.updated(),
+		Links: []opds.Link{
+			{Rel: "start", Href: "/opds", Type: typeNavigation},
+			{Rel: opds.RelSearch, Href: "/opds/osd", Type: opds.TypeOpenSearch},
+		},
+	}
+}
+
+func writeXML(w http.ResponseWriter, contentType string, v interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(v)
+}
+
+// navigation is an entry linking to another feed, typ is the type of that feed
+func navigation(id, title, href, typ string) *opds.Entry {
+	return &opds.Entry{
+		ID: "urn:calibrecli:" + id,
+		Title: title,
+		Links: []opds.Link{{Rel: "subsection", Href: href, Type: typ}},
+	}
+}
+
+func (s *Server) root(w http.ResponseWriter, r *http.Request) {
+	feed := s.feed("root", s.Title)
+	for _, e := range []*opds.Entry{
+		navigation("books", "All books", "/opds/books", typeAcquisition),
+		navigation("new", "Recently added", "/opds/new", typeAcquisition),
+		navigation("author", "Authors", "/opds/author", typeNavigation),
+		navigation("series", "Series", "/opds/series", typeNavigation),
+	} {
+		e.Updated = feed.Updated
+		feed.Entries = append(feed.Entries, e)
+	}
+	writeXML(w, typeNavigation, feed)
+}
+
+// books writes a page of books, selected by the offset query parameter
+func (s *Server) books(w http.ResponseWriter, r *http.Request, id, title string, books []*Book) {
+	size := s.PageSize
+	if size <= 0 { size = 30 }
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 || offset > len(books) { offset = len(books) }
+	end := offset + size
+	if end > len(books) { end = len(books) }
+
+	feed := s.feed(id, title)
+	feed.TotalResults, feed.ItemsPerPage, feed.StartIndex = len(books), size, offset + 1
+	if end < len(books) {
+		q := r.URL.Query()
+		q.Set("offset", strconv.Itoa(end))
+		feed.Links = append(feed.Links, opds.Link{Rel: opds.RelNext, Href: r.URL.Path + "?" + q.Encode(), Type: typeAcquisition})
+	}
+	for _, book := range books[offset:end] { feed.Entries = append(feed.Entries, entry(book)) }
+	writeXML(w, typeAcquisition, feed)
+}
+
+// entry describes a book the way calibre-web does, with the series in the calibre namespace
+func entry(book *Book) *opds.Entry {
+	e := &opds.Entry{
+		ID: fmt.Sprintf("urn:calibrecli:book:%d", book.ID),
+		Title: book.Title,
+		Updated: book.Modified.UTC().Format(time.RFC3339),
+		Summary: book.Description,
+		Languages: book.Languages,
+		DCPublisher: book.Publisher,
+		Series: book.Series,
+	}
+	for _, author := range book.Authors { e.Authors = append(e.Authors, opds.Person{Name: author}) }
+	for _, tag := range book.Tags { e.Categories = append(e.Categories, opds.Category{Term: tag, Label: tag}) }
+	if book.Published != nil { e.Issued = book.Published.Format("2006-01-02") }
+	if book.Series != "" { e.SeriesIndex = strconv.FormatFloat(book.SeriesIndex, 'f', -1, 64) }
+
+	types := make([]string, 0, len(book.Identifiers))
+	for t := range book.Identifiers { types = append(types, t) }
+	sort.Strings(types)
+	for _, t := range types { e.Identifiers = append(e.Identifiers, fmt.Sprintf("urn:%s:%s", t, book.Identifiers[t])) }
+
+	if book.Cover != "" {
+		href := fmt.Sprintf("/opds/cover/%d", book.ID)
+		e.Links = append(e.Links, opds.Link{Rel: opds.RelImage, Href: href, Type: "image/jpeg"}, opds.Link{Rel: opds.RelThumbnail, Href: href, Type: "image/jpeg"})
+	}
+	for _, f := range format.All {
+		if _, ok := book.Files[f]; !ok { continue }
+		e.Links = append(e.Links, opds.Link{
+			Rel: opds.RelAcquisition,
+			Href: fmt.Sprintf("/opds/download/%d/%s/", book.ID, f.Ext()),
+			Type: f.ContentType(),
+		})
+	}
+	return e
+}
+
+// names returns the authors or the series of a book
+func names(book *Book, kind string) []string {
+	if kind == "author" { return book.Authors }
+	if book.Series == "" { return nil }
+	return []string{book.Series}
+}
+
+// index lists the authors or series with links to their books
+func (s *Server) index(w http.ResponseWriter, r *http.Request, kind string) {
+	counts := map[string]int{}
+	for _, book := range s.Library.Books {
+		for _, name := range names(book, kind) { counts[name]++ }
+	}
+	sorted := make([]string, 0, len(counts))
+	for name := range counts { sorted = append(sorted, name) }
+	sort.Strings(sorted)
+
+	title := "Authors"
+	if kind == "series" { title = "Series" }
+	feed := s.feed(kind, title)
+	for _, name := range sorted {
+		e := navigation(kind + ":" + name, name, fmt.Sprintf("/opds/%s/%s", kind, url.PathEscape(name)), typeAcquisition)
+		e.Updated = feed.Updated
+		e.Content = &opds.Content{Type: "text", Body: fmt.Sprintf("%d books", counts[name])}
+		feed.Entries = append(feed.Entries, e)
+	}
+	writeXML(w, typeNavigation, feed)
+}
+
+func (s *Server) indexBooks(w http.ResponseWriter, r *http.Request, kind, name string) {
+	books := []*Book{}
+	for _, book := range s.Library.Books {
+		for _, n := range names(book, kind) {
+			if n == name { books = append(books, book) }
+		}
+	}
+	if kind == "series" {
+		sort.SliceStable(books, func(i, j int) bool { return books[i].SeriesIndex < books[j].SeriesIndex })
+	}
+	s.books(w, r, kind + ":" + name, name, books)
+}
+
+// search matches every word of query against title, authors, tags and series
+func (s *Server) search(query string) []*Book {
+	words := strings.Fields(strings.ToLower(query))
+	books := []*Book{}
+	for _, book := range s.Library.Books {
+		text := strings.ToLower(strings.Join(append(append([]string{book.Title, book.Series}, book.Authors...), book.Tags...), " "))
+		match := len(words) > 0
+		for _, word := range words {
+			if !strings.Contains(text, word) { match = false }
+		}
+		if match { books = append(books, book) }
+	}
+	return books
+}
+
+func (s *Server) osd(w http.ResponseWriter, r *http.Request) {
+	writeXML(w, opds.TypeOpenSearch, &opds.OpenSearchDescription{
+		NS: opds.NSOpenSearch,
+		ShortName: s.Title,
+		Description: "Search " + s.Title,
+		URLs: []opds.OpenSearchURL{{Type: typeAcquisition, Template: "/opds/search/{searchTerms}"}},
+	})
+}
+
+func (s *Server) bookFromPath(w http.ResponseWriter, r *http.Request, id string) (*Book, bool) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	book, ok := s.Library.Book(n)
+	if !ok { http.NotFound(w, r) }
+	return book, ok
+}
+
+// download serves /opds/download/{id}/{format}
+func (s *Server) download(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) < 2 {
+		http.NotFound(w, r)
+		return
+	}
+	book, ok := s.bookFromPath(w, r, parts[0])
+	if !ok { return }
+	f, ok := format.FromExt(parts[1])
+	file, found := book.Files[f]
+	if !ok || !found {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", f.ContentType())
+	w.Header().Set("Content-Disposition", "attachment; filename=" + url.PathEscape(filepath.Base(file)))
+	http.ServeFile(w, r, file)
+}
+
+func (s *Server) cover(w http.ResponseWriter, r *http.Request, id string) {
+	book, ok := s.bookFromPath(w, r, id)
+	if !ok { return }
+	if book.Cover == "" {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, book.Cover)
+}
@@ -0,0 +1,120 @@
+// Package lint checks the books of a library with pluggable rules
+package lint
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/yrhki/gocalibre/calibre-web"
+)
+
+// Book is a book with the details rules need that are not on calibre.Book
+type Book struct {
+	*calibre.Book
+	HasCover bool
+}
+
+type Issue struct {
+	Rule string `json:"rule"`
+	BookID uint64 `json:"book_id"`
+	Title string `json:"title"`
+	Message string `json:"message"`
+	// Fix changes the book to resolve the issue, it is nil for issues without a safe fix
+	Fix func(book *calibre.Book) `json:"-"`
+}
+
+func (i Issue) Fixable() bool { return i.Fix != nil }
+
+// Rule checks all books at once, so rules can compare books with each other
+type Rule interface {
+	Name() string
+	Description() string
+	Check(books []*Book) []Issue
+}
+
+// BookRule is a Rule that checks every book on its own
+type BookRule struct {
+	RuleName, Desc string
+	CheckBook func(book *Book) []Issue
+}
+
+func (r *BookRule) Name() string { return r.RuleName }
+func (r *BookRule) Description() string { return r.Desc }
+
+func (r *BookRule) Check(books []*Book) []Issue {
+	issues := []Issue{}
+	for _, book := range books { issues = append(issues, r.CheckBook(book)...) }
+	return issues
+}
+
+// issue creates an issue of rule for book
+func issue(rule string, book *Book, format string, args ...interface{}) Issue {
+	return Issue{Rule: rule, BookID: book.ID(), Title: book.Title, Message: fmt.Sprintf(format, args...)}
+}
+
+// Load reads every book of the library with its cover state
+func Load(ctx context.Context, api *calibre.API) ([]*Book, error) {
+	list, err := api.ListBooks()
+	if err != nil { return nil, err }
+	books := make([]*Book, 0, len(list))
+	for _, b := range list {
+		book, err := api.BookByID(b.ID())
+		if err != nil { return nil, fmt.Errorf("book %d: %w", b.ID(), err) }
+		hasCover, err := api.HasCover(ctx, b.ID())
+		if err != nil { return nil, fmt.Errorf("book %d: %w", b.ID(), err) }
+		books = append(books, &Book{Book: book, HasCover: hasCover})
+	}
+	return books, nil
+}
+
+// Run checks books with every rule. Issues are sorted by rule and book.
+func Run(rules []Rule, books []*Book) []Issue {
+	issues := []Issue{}
+	for _, rule := range rules { issues = append(issues, rule.Check(books)...) }
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Rule != issues[j].Rule { return issues[i].Rule < issues[j].Rule }
+		return issues[i].BookID < issues[j].BookID
+	})
+	return issues
+}
+
+// Fix applies the fixes of issues to books and saves every changed book
+// once. It returns the issues that were fixed and an error for every book
+// that could not be saved, those books are left unchanged.
+func Fix(api *calibre.API, books []*Book, issues []Issue) ([]Issue, []error) {
+	byID := map[uint64]*Book{}
+	for _, book := range books { byID[book.ID()] = book }
+
+	changed, pending := []*Book{}, map[uint64][]Issue{}
+	for _, i := range issues {
+		if _, ok := byID[i.BookID]; !ok || !i.Fixable() { continue }
+		if pending[i.BookID] == nil { changed = append(changed, byID[i.BookID]) }
+		pending[i.BookID] = append(pending[i.BookID], i)
+	}
+
+	fixed, errs := []Issue{}, []error{}
+	for _, book := range changed {
+		b := copyBook(book.Book)
+		for _, i := range pending[book.ID()] { i.Fix(b) }
+		err := api.UpdateBookMetadata(b)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("book %d: %w", book.ID(), err))
+			continue
+		}
+		*book.Book = *b
+		fixed = append(fixed, pending[book.ID()]...)
+	}
+	return fixed, errs
+}
+
+// copyBook copies the fields fixes change, so a book that fails to save keeps its state
+func copyBook(book *calibre.Book) *calibre.Book {
+	b := *book
+	b.Authors = append([]string(nil), book.Authors...)
+	b.Categories = append([]string(nil), book.Categories...)
+	b.Languages = append([]string(nil), book.Languages...)
+	b.Identifiers = make(calibre.BookIdentifiers, len(book.Identifiers))
+	for t, v := range book.Identifiers { b.Identifiers[t] = v }
+	return &b
+}
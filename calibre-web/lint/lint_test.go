@@ -0,0 +1,166 @@
+package lint
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/yrhki/gocalibre/calibre-web"
+	"github.com/yrhki/gocalibre/calibre-web/opds"
+)
+
+// newBook creates a book with id and one format through an OPDS entry, as
+// the id of calibre.Book can't be set otherwise
+func newBook(t *testing.T, id uint64, ext string, edit func(b *calibre.Book)) *Book {
+	e := &opds.Entry{
+		Title: fmt.Sprintf("Book %d", id),
+		Links: []opds.Link{{Rel: opds.RelAcquisition, Href: fmt.Sprintf("/opds/download/%d/%s/", id, ext)}},
+	}
+	b, err := calibre.BookFromEntry(e)
+	if err != nil { t.Fatal(err) }
+	b.Description = "Description"
+	b.Languages = []string{"eng"}
+	if edit != nil { edit(b) }
+	return &Book{Book: b, HasCover: true}
+}
+
+// summary lists issues as "rule book", which is what most tests compare
+func summary(issues []Issue) []string {
+	s := []string{}
+	for _, i := range issues { s = append(s, fmt.Sprintf("%s %d", i.Rule, i.BookID)) }
+	return s
+}
+
+func TestBookRules(t *testing.T) {
+	books := []*Book{
+		newBook(t, 1, "epub", nil),
+		newBook(t, 2, "pdf", func(b *calibre.Book) { b.Description = " " }),
+		newBook(t, 3, "epub", func(b *calibre.Book) { b.Languages = nil }),
+		newBook(t, 4, "epub", func(b *calibre.Book) { b.Identifiers = calibre.BookIdentifiers{"isbn": "9780261102355", "doi": "10.1000/182", "issn": "1234"} }),
+	}
+	books[0].HasCover = false
+
+	got := summary(Run([]Rule{MissingCover, EmptyDescription, NoLanguage, PDFOnly, InvalidIdentifier}, books))
+	want := []string{"empty-description 2", "invalid-identifier 4", "invalid-identifier 4", "missing-cover 1", "no-language 3", "pdf-only 2"}
+	if !reflect.DeepEqual(got, want) { t.Errorf("got %q, want %q", got, want) }
+}
+
+func TestAuthorNameFormat(t *testing.T) {
+	authors := func(names ...string) func(b *calibre.Book) { return func(b *calibre.Book) { b.Authors = names } }
+	books := []*Book{
+		newBook(t, 1, "epub", authors("Ursula K. Le Guin")),
+		newBook(t, 2, "epub", authors("J.R.R. Tolkien", "Christopher Tolkien")),
+		newBook(t, 3, "epub", authors("Pratchett, Terry")),
+		newBook(t, 4, "epub", authors("Martin Luther King, Jr.", "King, Martin Luther, Jr.", "Gates, Henry Louis, III")),
+	}
+
+	issues := AuthorNameFormat{}.Check(books)
+	if got, want := summary(issues), []string{"author-name-format 3"}; !reflect.DeepEqual(got, want) { t.Fatalf("got %q, want %q", got, want) }
+	issues[0].Fix(books[2].Book)
+	if want := []string{"Terry Pratchett"}; !reflect.DeepEqual(books[2].Authors, want) { t.Errorf("fixed to %q, want %q", books[2].Authors, want) }
+
+	// With a "Last, First" majority "First Last" names are reported without fix
+	books = []*Book{
+		newBook(t, 1, "epub", authors("Le Guin, Ursula K.", "Tolkien, J.R.R.")),
+		newBook(t, 2, "epub", authors("Terry Pratchett", "Martin Luther King, Jr.")),
+	}
+	issues = AuthorNameFormat{}.Check(books)
+	if got, want := summary(issues), []string{"author-name-format 2"}; !reflect.DeepEqual(got, want) { t.Fatalf("got %q, want %q", got, want) }
+	if issues[0].Fixable() { t.Error("\"First Last\" can't be fixed safely") }
+}
+
+func TestNameOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		lastFirst, ok bool
+	}{
+		{"Terry Pratchett", false, true},
+		{"Pratchett, Terry", true, true},
+		{"Le Guin, Ursula K.", true, true},
+		{"Martin Luther King, Jr.", false, false},
+		{"Martin Luther King, Jr", false, false},
+		{"John Smith, Sr.", false, false},
+		{"Henry Louis Gates, III", false, false},
+		{"King, Martin Luther, Jr.", false, false},
+		{", Terry", false, false},
+		{"Pratchett,", false, false},
+	}
+	for _, test := range tests {
+		lastFirst, ok := nameOrder(test.name)
+		if lastFirst != test.lastFirst || ok != test.ok { t.Errorf("nameOrder(%q) = %v, %v", test.name, lastFirst, ok) }
+	}
+}
+
+func TestSeriesGaps(t *testing.T) {
+	series := func(name string, index float64) func(b *calibre.Book) {
+		return func(b *calibre.Book) { b.Series, b.SeriesIndex = name, index }
+	}
+	books := []*Book{
+		newBook(t, 1, "epub", series("Discworld", 1)),
+		newBook(t, 2, "epub", series("Discworld", 4)),
+		newBook(t, 3, "epub", series("Discworld", 4)),
+		newBook(t, 4, "epub", series("Discworld", 4.5)),
+		newBook(t, 5, "epub", series("Earthsea", 1)),
+		newBook(t, 6, "epub", series("Earthsea", 2)),
+		newBook(t, 7, "epub", nil),
+	}
+
+	issues := Run([]Rule{SeriesGaps{}}, books)
+	messages := []string{}
+	for _, i := range issues { messages = append(messages, fmt.Sprintf("%d %s", i.BookID, i.Message)) }
+	want := []string{"2 Discworld: missing 2, 3 before 4", "3 Discworld: index 4 is also used by book 2"}
+	if !reflect.DeepEqual(messages, want) { t.Errorf("got %q, want %q", messages, want) }
+}
+
+func TestTagCasing(t *testing.T) {
+	tags := func(names ...string) func(b *calibre.Book) { return func(b *calibre.Book) { b.Categories = names } }
+	books := []*Book{
+		newBook(t, 1, "epub", tags("Fantasy", "Humour")),
+		newBook(t, 2, "epub", tags("Fantasy")),
+		newBook(t, 3, "epub", tags("fantasy", "Fantasy")),
+		newBook(t, 4, "epub", tags("humour")),
+	}
+
+	issues := Run([]Rule{TagCasing{}}, books)
+	if got, want := summary(issues), []string{"tag-casing 3", "tag-casing 4"}; !reflect.DeepEqual(got, want) { t.Fatalf("got %q, want %q", got, want) }
+	issues[0].Fix(books[2].Book)
+	if want := []string{"Fantasy"}; !reflect.DeepEqual(books[2].Categories, want) { t.Errorf("fixed to %q, want %q", books[2].Categories, want) }
+	issues[1].Fix(books[3].Book)
+	if want := []string{"Humour"}; !reflect.DeepEqual(books[3].Categories, want) { t.Errorf("fixed to %q, want the alphabetically first spelling %q", books[3].Categories, want) }
+}
+
+func TestFix(t *testing.T) {
+	saved := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		saved[r.URL.Path]++
+		if r.URL.Path == "/admin/book/2" {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("<html></html>"))
+	}))
+	defer server.Close()
+	api, err := calibre.NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+
+	tags := func(names ...string) func(b *calibre.Book) { return func(b *calibre.Book) { b.Categories = names } }
+	books := []*Book{
+		newBook(t, 1, "epub", tags("fantasy", "humour")),
+		newBook(t, 2, "epub", tags("fantasy")),
+		newBook(t, 3, "epub", tags("Fantasy", "Humour")),
+		newBook(t, 4, "epub", tags("Fantasy", "Humour")),
+		newBook(t, 5, "epub", tags("Fantasy")),
+	}
+	issues := Run([]Rule{TagCasing{}, MissingCover}, books)
+
+	fixed, errs := Fix(api, books, issues)
+	if got, want := summary(fixed), []string{"tag-casing 1", "tag-casing 1"}; !reflect.DeepEqual(got, want) { t.Errorf("fixed %q, want %q", got, want) }
+	if len(errs) != 1 { t.Fatalf("got errors %v, want one for book 2", errs) }
+	if want := map[string]int{"/admin/book/1": 1, "/admin/book/2": 1}; !reflect.DeepEqual(saved, want) { t.Errorf("saved %v, want every changed book once", saved) }
+
+	if want := []string{"Fantasy", "Humour"}; !reflect.DeepEqual(books[0].Categories, want) { t.Errorf("book 1 tags %q, want %q", books[0].Categories, want) }
+	if want := []string{"fantasy"}; !reflect.DeepEqual(books[1].Categories, want) { t.Errorf("book 2 tags %q were changed without being saved", books[1].Categories) }
+	if got, want := summary(Run([]Rule{TagCasing{}}, books)), []string{"tag-casing 2"}; !reflect.DeepEqual(got, want) { t.Errorf("remaining %q, want %q", got, want) }
+}
@@ -0,0 +1,91 @@
+package lint
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// WriteTable writes the issues as aligned columns
+func WriteTable(w io.Writer, issues []Issue) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "RULE\tBOOK\tTITLE\tISSUE\tFIX")
+	for _, i := range issues {
+		fix := ""
+		if i.Fixable() { fix = "yes" }
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", i.Rule, i.BookID, i.Title, i.Message, fix)
+	}
+	return tw.Flush()
+}
+
+type jsonIssue struct {
+	Issue
+	Fixable bool `json:"fixable"`
+}
+
+func WriteJSON(w io.Writer, issues []Issue) error {
+	list := make([]jsonIssue, 0, len(issues))
+	for _, i := range issues { list = append(list, jsonIssue{i, i.Fixable()}) }
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(list)
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type junitCase struct {
+	Name string `xml:"name,attr"`
+	Classname string `xml:"classname,attr"`
+	Failure *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitSuite struct {
+	Name string `xml:"name,attr"`
+	Tests int `xml:"tests,attr"`
+	Failures int `xml:"failures,attr"`
+	Cases []junitCase `xml:"testcase"`
+}
+
+type junitSuites struct {
+	XMLName xml.Name `xml:"testsuites"`
+	Name string `xml:"name,attr"`
+	Tests int `xml:"tests,attr"`
+	Failures int `xml:"failures,attr"`
+	Suites []junitSuite `xml:"testsuite"`
+}
+
+// WriteJUnit writes a test suite per rule with a failing test case per issue.
+// Rules without issues get a single passing test case.
+func WriteJUnit(w io.Writer, rules []Rule, issues []Issue) error {
+	report := junitSuites{Name: "calibre-lint"}
+	for _, rule := range rules {
+		suite := junitSuite{Name: rule.Name()}
+		for _, i := range issues {
+			if i.Rule != rule.Name() { continue }
+			suite.Cases = append(suite.Cases, junitCase{
+				Name: fmt.Sprintf("%d: %s", i.BookID, i.Title),
+				Classname: rule.Name(),
+				Failure: &junitFailure{Message: i.Message, Type: rule.Description()},
+			})
+		}
+		suite.Failures = len(suite.Cases)
+		if suite.Failures == 0 { suite.Cases = []junitCase{{Name: "all books", Classname: rule.Name()}} }
+		suite.Tests = len(suite.Cases)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Suites = append(report.Suites, suite)
+	}
+
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err := enc.Encode(report)
+	if err != nil { return err }
+	_, err = io.WriteString(w, "\n")
+	return err
+}
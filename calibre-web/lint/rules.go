@@ -0,0 +1,215 @@
+package lint
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/yrhki/gocalibre/calibre-web"
+)
+
+// DefaultRules are the rules calibrecli lint runs
+func DefaultRules() []Rule {
+	return []Rule{
+		MissingCover,
+		EmptyDescription,
+		NoLanguage,
+		PDFOnly,
+		InvalidIdentifier,
+		AuthorNameFormat{},
+		SeriesGaps{},
+		TagCasing{},
+	}
+}
+
+var MissingCover = &BookRule{"missing-cover", "book has no cover", func(book *Book) []Issue {
+	if book.HasCover { return nil }
+	return []Issue{issue("missing-cover", book, "no cover")}
+}}
+
+var EmptyDescription = &BookRule{"empty-description", "book has no description", func(book *Book) []Issue {
+	if strings.TrimSpace(book.Description) != "" { return nil }
+	return []Issue{issue("empty-description", book, "no description")}
+}}
+
+var NoLanguage = &BookRule{"no-language", "book has no language", func(book *Book) []Issue {
+	if len(book.Languages) > 0 { return nil }
+	return []Issue{issue("no-language", book, "no language")}
+}}
+
+var PDFOnly = &BookRule{"pdf-only", "PDF is the only format, which reads badly on eReaders", func(book *Book) []Issue {
+	formats := book.Formats()
+	if len(formats) != 1 || formats[0] != calibre.FormatPDF { return nil }
+	return []Issue{issue("pdf-only", book, "only PDF")}
+}}
+
+var InvalidIdentifier = &BookRule{"invalid-identifier", "ISBN, ISSN or DOI is malformed", func(book *Book) []Issue {
+	types := make([]string, 0, len(book.Identifiers))
+	for t := range book.Identifiers { types = append(types, t) }
+	sort.Strings(types)
+
+	issues := []Issue{}
+	for _, t := range types {
+		err := calibre.BookIdentifiers{t: book.Identifiers[t]}.Validate()
+		if err != nil { issues = append(issues, issue("invalid-identifier", book, "%s", err)) }
+	}
+	return issues
+}}
+
+// AuthorNameFormat reports authors written as "Last, First" when most
+// authors of the library are "First Last" and the other way around. Only
+// "Last, First" can be fixed safely, last names may have several words.
+// Names with a suffix like "King, Jr." or several commas are ignored.
+type AuthorNameFormat struct{}
+
+func (AuthorNameFormat) Name() string { return "author-name-format" }
+func (AuthorNameFormat) Description() string { return "author names mix \"Last, First\" and \"First Last\"" }
+
+var nameSuffixes = map[string]bool{"jr": true, "sr": true, "ii": true, "iii": true, "iv": true, "phd": true, "md": true, "esq": true}
+
+// nameOrder reports whether name is written as "Last, First", ok is false
+// if the order can't be told
+func nameOrder(name string) (lastFirst, ok bool) {
+	switch strings.Count(name, ",") {
+	case 0:
+		return false, true
+	case 1:
+		sp := strings.SplitN(name, ",", 2)
+		after := strings.ToLower(strings.NewReplacer(".", "", " ", "").Replace(sp[1]))
+		if strings.TrimSpace(sp[0]) == "" || after == "" || nameSuffixes[after] { return false, false }
+		return true, true
+	}
+	return false, false
+}
+
+func firstLast(name string) string {
+	sp := strings.SplitN(name, ",", 2)
+	return strings.TrimSpace(sp[1]) + " " + strings.TrimSpace(sp[0])
+}
+
+func (r AuthorNameFormat) Check(books []*Book) []Issue {
+	names := map[string]bool{}
+	for _, book := range books {
+		for _, author := range book.Authors { names[author] = true }
+	}
+	var lastFirst, known int
+	for name := range names {
+		isLastFirst, ok := nameOrder(name)
+		if !ok { continue }
+		known++
+		if isLastFirst { lastFirst++ }
+	}
+	if lastFirst == 0 || lastFirst == known { return nil }
+	majorityLastFirst := lastFirst * 2 > known
+
+	issues := []Issue{}
+	for _, book := range books {
+		for _, author := range book.Authors {
+			isLastFirst, ok := nameOrder(author)
+			if !ok || isLastFirst == majorityLastFirst { continue }
+			if majorityLastFirst {
+				issues = append(issues, issue(r.Name(), book, "%q is not written as \"Last, First\"", author))
+				continue
+			}
+			i := issue(r.Name(), book, "%q is not written as \"First Last\"", author)
+			author := author
+			i.Fix = func(b *calibre.Book) {
+				for n, a := range b.Authors {
+					if a == author { b.Authors[n] = firstLast(a) }
+				}
+			}
+			issues = append(issues, i)
+		}
+	}
+	return issues
+}
+
+// SeriesGaps reports missing and duplicate whole numbered series indexes
+type SeriesGaps struct{}
+
+func (SeriesGaps) Name() string { return "series-gaps" }
+func (SeriesGaps) Description() string { return "series index is missing or used twice" }
+
+func (r SeriesGaps) Check(books []*Book) []Issue {
+	series := map[string][]*Book{}
+	for _, book := range books {
+		if book.Series != "" { series[book.Series] = append(series[book.Series], book) }
+	}
+
+	issues := []Issue{}
+	for name, list := range series {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].SeriesIndex < list[j].SeriesIndex })
+		next := 1.0
+		for i, book := range list {
+			index := book.SeriesIndex
+			// Fractional indexes are novellas between the numbered books
+			if index != math.Trunc(index) { continue }
+			if i > 0 && list[i-1].SeriesIndex == index {
+				issues = append(issues, issue(r.Name(), book, "%s: index %v is also used by book %d", name, index, list[i-1].ID()))
+				continue
+			}
+			if index > next {
+				missing := []string{}
+				for n := next; n < index; n++ { missing = append(missing, fmt.Sprint(n)) }
+				issues = append(issues, issue(r.Name(), book, "%s: missing %s before %v", name, strings.Join(missing, ", "), index))
+			}
+			next = index + 1
+		}
+	}
+	return issues
+}
+
+// TagCasing reports tags that only differ in case from a more used tag.
+// The fix replaces them with the most used spelling.
+type TagCasing struct{}
+
+func (TagCasing) Name() string { return "tag-casing" }
+func (TagCasing) Description() string { return "tag differs only in case from another tag" }
+
+func (r TagCasing) Check(books []*Book) []Issue {
+	counts := map[string]map[string]int{}
+	for _, book := range books {
+		for _, tag := range book.Categories {
+			key := strings.ToLower(tag)
+			if counts[key] == nil { counts[key] = map[string]int{} }
+			counts[key][tag]++
+		}
+	}
+
+	canonical := map[string]string{}
+	for key, spellings := range counts {
+		if len(spellings) < 2 { continue }
+		best := ""
+		for tag, n := range spellings {
+			if best == "" || n > spellings[best] || n == spellings[best] && tag < best { best = tag }
+		}
+		canonical[key] = best
+	}
+
+	issues := []Issue{}
+	for _, book := range books {
+		for _, tag := range book.Categories {
+			want, ok := canonical[strings.ToLower(tag)]
+			if !ok || tag == want { continue }
+			i := issue(r.Name(), book, "tag %q should be %q", tag, want)
+			tag := tag
+			i.Fix = func(b *calibre.Book) { b.Categories = replaceTag(b.Categories, tag, want) }
+			issues = append(issues, i)
+		}
+	}
+	return issues
+}
+
+// replaceTag renames a tag and drops the duplicate if the book has both spellings
+func replaceTag(tags []string, old, want string) []string {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		if tag == old { tag = want }
+		if seen[tag] { continue }
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
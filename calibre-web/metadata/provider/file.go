@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/yrhki/gocalibre/calibre-web/identifier"
+)
+
+// File looks up candidates in a JSON file with an array of Candidate,
+// for curated metadata that is not online
+type File struct {
+	Path string
+}
+
+func (f *File) Name() string { return "file" }
+
+// Lookup matches the ISBN exactly, otherwise the title and the first author
+// without case and as substring
+func (f *File) Lookup(ctx context.Context, q Query) ([]Candidate, error) {
+	b, err := ioutil.ReadFile(f.Path)
+	if err != nil { return nil, err }
+	all := []Candidate{}
+	err = json.Unmarshal(b, &all)
+	if err != nil { return nil, err }
+
+	contains := func(s, sub string) bool { return strings.Contains(strings.ToLower(s), strings.ToLower(sub)) }
+	candidates := []Candidate{}
+	for _, c := range all {
+		if q.ISBN != "" {
+			if identifier.CleanISBN(c.Identifiers["isbn"]) != identifier.CleanISBN(q.ISBN) { continue }
+		} else {
+			if q.Title == "" || !contains(c.Title, q.Title) { continue }
+			if len(q.Authors) > 0 && !contains(strings.Join(c.Authors, " "), q.Authors[0]) { continue }
+		}
+		if c.Source == "" { c.Source = f.Name() }
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
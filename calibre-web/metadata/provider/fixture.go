@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// fixture is a recorded HTTP response
+type fixture struct {
+	Method string `json:"method"`
+	URL string `json:"url"`
+	Status int `json:"status"`
+	Header http.Header `json:"header"`
+	Body string `json:"body"`
+}
+
+// fixtureURL is the URL of a request without API keys
+func fixtureURL(req *http.Request) string {
+	u := *req.URL
+	q := u.Query()
+	q.Del("key")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// fixtureKey names the fixture file of a request
+func fixtureKey(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.Method + " " + fixtureURL(req)))
+	return hex.EncodeToString(sum[:8]) + ".json"
+}
+
+// Recorder saves every response of Transport to Dir, which
+// Replay serves without network
+type Recorder struct {
+	Dir string
+	// Transport defaults to http.DefaultTransport
+	Transport http.RoundTripper
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	t := r.Transport
+	if t == nil { t = http.DefaultTransport }
+	resp, err := t.RoundTrip(req)
+	if err != nil { return nil, err }
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil { return nil, err }
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	b, err := json.MarshalIndent(fixture{req.Method, fixtureURL(req), resp.StatusCode, resp.Header, string(body)}, "", "\t")
+	if err != nil { return nil, err }
+	err = os.MkdirAll(r.Dir, 0755)
+	if err != nil { return nil, err }
+	return resp, ioutil.WriteFile(filepath.Join(r.Dir, fixtureKey(req)), b, 0644)
+}
+
+// Replay answers requests with the responses a Recorder saved in Dir.
+// Requests without fixture fail.
+type Replay struct {
+	Dir string
+}
+
+func (r *Replay) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, err := ioutil.ReadFile(filepath.Join(r.Dir, fixtureKey(req)))
+	if os.IsNotExist(err) { return nil, fmt.Errorf("no fixture for %s %s", req.Method, req.URL) }
+	if err != nil { return nil, err }
+	f := new(fixture)
+	err = json.Unmarshal(b, f)
+	if err != nil { return nil, err }
+	return &http.Response{
+		Status: fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		StatusCode: f.Status,
+		Proto: "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: f.Header,
+		Body: ioutil.NopCloser(bytes.NewReader([]byte(f.Body))),
+		ContentLength: int64(len(f.Body)),
+		Request: req,
+	}, nil
+}
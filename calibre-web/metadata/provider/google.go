@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/yrhki/gocalibre/calibre-web/identifier"
+)
+
+// GoogleBooks searches the Google Books API
+type GoogleBooks struct {
+	// URL defaults to https://www.googleapis.com/books/v1
+	URL string
+	// Key is an optional API key
+	Key string
+	Client *http.Client
+	// Limit is the maximum number of candidates, 5 if 0
+	Limit int
+}
+
+func (gb *GoogleBooks) Name() string { return "google" }
+
+type googleVolume struct {
+	ID string `json:"id"`
+	VolumeInfo struct {
+		Title string `json:"title"`
+		Subtitle string `json:"subtitle"`
+		Authors []string `json:"authors"`
+		Publisher string `json:"publisher"`
+		PublishedDate string `json:"publishedDate"`
+		Description string `json:"description"`
+		IndustryIdentifiers []struct {
+			Type string `json:"type"`
+			Identifier string `json:"identifier"`
+		} `json:"industryIdentifiers"`
+		Categories []string `json:"categories"`
+		Language string `json:"language"`
+		ImageLinks map[string]string `json:"imageLinks"`
+	} `json:"volumeInfo"`
+}
+
+func (gb *GoogleBooks) Lookup(ctx context.Context, q Query) ([]Candidate, error) {
+	base := gb.URL
+	if base == "" { base = "https://www.googleapis.com/books/v1" }
+	limit := gb.Limit
+	if limit <= 0 { limit = 5 }
+
+	terms := []string{}
+	if q.ISBN != "" {
+		terms = append(terms, "isbn:" + identifier.CleanISBN(q.ISBN))
+	} else {
+		if q.Title != "" { terms = append(terms, "intitle:" + q.Title) }
+		if len(q.Authors) > 0 { terms = append(terms, "inauthor:" + q.Authors[0]) }
+	}
+	params := url.Values{"q": {strings.Join(terms, " ")}, "maxResults": {fmt.Sprint(limit)}}
+	if gb.Key != "" { params.Set("key", gb.Key) }
+
+	var result struct {
+		Items []googleVolume `json:"items"`
+	}
+	err := getJSON(ctx, gb.Client, strings.TrimSuffix(base, "/") + "/volumes?" + params.Encode(), &result)
+	if err != nil { return nil, fmt.Errorf("google: %w", err) }
+
+	candidates := []Candidate{}
+	for _, item := range result.Items {
+		info := item.VolumeInfo
+		c := Candidate{
+			Source: gb.Name(),
+			Title: info.Title,
+			Authors: info.Authors,
+			Publisher: info.Publisher,
+			Published: parseDate(info.PublishedDate),
+			Description: info.Description,
+			Tags: info.Categories,
+			Identifiers: map[string]string{"google": item.ID},
+		}
+		if info.Subtitle != "" { c.Title += ": " + info.Subtitle }
+		if info.Language != "" { c.Languages = []string{info.Language} }
+		for _, id := range info.IndustryIdentifiers {
+			switch id.Type {
+			case "ISBN_13":
+				c.Identifiers["isbn"] = id.Identifier
+			case "ISBN_10":
+				if c.Identifiers["isbn"] == "" { c.Identifiers["isbn"] = id.Identifier }
+			case "ISSN":
+				c.Identifiers["issn"] = id.Identifier
+			}
+		}
+		for _, size := range []string{"extraLarge", "large", "medium", "thumbnail"} {
+			if u := info.ImageLinks[size]; u != "" && c.CoverURL == "" { c.CoverURL = strings.Replace(u, "http://", "https://", 1) }
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
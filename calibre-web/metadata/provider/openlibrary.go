@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/yrhki/gocalibre/calibre-web/identifier"
+)
+
+// OpenLibrary searches openlibrary.org
+type OpenLibrary struct {
+	// URL defaults to https://openlibrary.org
+	URL string
+	Client *http.Client
+	// Limit is the maximum number of candidates, 5 if 0
+	Limit int
+}
+
+func (ol *OpenLibrary) Name() string { return "openlibrary" }
+
+type openLibraryDoc struct {
+	Key string `json:"key"`
+	Title string `json:"title"`
+	Subtitle string `json:"subtitle"`
+	AuthorName []string `json:"author_name"`
+	Publisher []string `json:"publisher"`
+	PublishDate []string `json:"publish_date"`
+	FirstPublishYear int `json:"first_publish_year"`
+	ISBN []string `json:"isbn"`
+	Language []string `json:"language"`
+	Subject []string `json:"subject"`
+	CoverID int `json:"cover_i"`
+}
+
+func (ol *OpenLibrary) Lookup(ctx context.Context, q Query) ([]Candidate, error) {
+	base := ol.URL
+	if base == "" { base = "https://openlibrary.org" }
+	limit := ol.Limit
+	if limit <= 0 { limit = 5 }
+
+	params := url.Values{"limit": {fmt.Sprint(limit)}}
+	if q.ISBN != "" {
+		params.Set("isbn", identifier.CleanISBN(q.ISBN))
+	} else {
+		params.Set("title", q.Title)
+		if len(q.Authors) > 0 { params.Set("author", q.Authors[0]) }
+	}
+
+	var result struct {
+		Docs []openLibraryDoc `json:"docs"`
+	}
+	err := getJSON(ctx, ol.Client, strings.TrimSuffix(base, "/") + "/search.json?" + params.Encode(), &result)
+	if err != nil { return nil, fmt.Errorf("openlibrary: %w", err) }
+
+	candidates := []Candidate{}
+	for _, doc := range result.Docs {
+		c := Candidate{
+			Source: ol.Name(),
+			Title: doc.Title,
+			Authors: doc.AuthorName,
+			Tags: doc.Subject,
+			Languages: doc.Language,
+			Identifiers: map[string]string{},
+		}
+		if doc.Subtitle != "" { c.Title += ": " + doc.Subtitle }
+		if len(doc.Publisher) > 0 { c.Publisher = doc.Publisher[0] }
+		if len(doc.PublishDate) > 0 { c.Published = parseDate(doc.PublishDate[0]) }
+		if c.Published == nil && doc.FirstPublishYear > 0 { c.Published = parseDate(fmt.Sprint(doc.FirstPublishYear)) }
+		// Subjects are long lists of loose keywords
+		if len(c.Tags) > 10 { c.Tags = c.Tags[:10] }
+
+		// Prefer the ISBN that was searched for, the docs list all editions
+		for _, isbn := range doc.ISBN {
+			if q.ISBN != "" && isbn == identifier.CleanISBN(q.ISBN) || c.Identifiers["isbn"] == "" && len(isbn) == 13 {
+				c.Identifiers["isbn"] = isbn
+			}
+		}
+		if doc.Key != "" { c.Identifiers["openlibrary"] = strings.TrimPrefix(doc.Key, "/works/") }
+		if doc.CoverID > 0 { c.CoverURL = fmt.Sprintf("https://covers.openlibrary.org/b/id/%d-L.jpg", doc.CoverID) }
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
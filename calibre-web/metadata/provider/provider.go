@@ -0,0 +1,81 @@
+// Package provider looks up book metadata in online and local sources
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Query describes the book to look up. ISBN is preferred if it is set.
+type Query struct {
+	Title string
+	Authors []string
+	ISBN string
+}
+
+func (q Query) String() string {
+	if q.ISBN != "" { return "isbn:" + q.ISBN }
+	return strings.TrimSpace(q.Title + " " + strings.Join(q.Authors, " "))
+}
+
+// Candidate is the metadata of a possible match
+type Candidate struct {
+	// Source is the name of the provider
+	Source string `json:"source,omitempty"`
+	Title string `json:"title"`
+	Authors []string `json:"authors,omitempty"`
+	Publisher string `json:"publisher,omitempty"`
+	Published *time.Time `json:"published,omitempty"`
+	Description string `json:"description,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+	Languages []string `json:"languages,omitempty"`
+	Series string `json:"series,omitempty"`
+	SeriesIndex float64 `json:"series_index,omitempty"`
+	Identifiers map[string]string `json:"identifiers,omitempty"`
+	CoverURL string `json:"cover_url,omitempty"`
+}
+
+type Provider interface {
+	Name() string
+	Lookup(ctx context.Context, q Query) ([]Candidate, error)
+}
+
+// parseDate parses the partial dates providers return, like 2001, May 2001 or 2001-05-02
+func parseDate(s string) *time.Time {
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006", "January 2, 2006", "Jan 2, 2006", "January 2006"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil { return &t }
+	}
+	return nil
+}
+
+// getJSON decodes a response of c, a nil c uses http.DefaultClient
+func getJSON(ctx context.Context, c *http.Client, u string, v interface{}) error {
+	if c == nil { c = http.DefaultClient }
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil { return err }
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.Do(req)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 { return fmt.Errorf("%s: %s", u, resp.Status) }
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// LookupAll queries every provider in order. Errors of single providers are
+// returned together with the candidates of the others.
+func LookupAll(ctx context.Context, providers []Provider, q Query) ([]Candidate, []error) {
+	candidates, errs := []Candidate{}, []error{}
+	for _, p := range providers {
+		c, err := p.Lookup(ctx, q)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+			continue
+		}
+		candidates = append(candidates, c...)
+	}
+	return candidates, errs
+}
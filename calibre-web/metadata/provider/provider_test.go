@@ -0,0 +1,166 @@
+package provider
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// replayClient serves the responses recorded in testdata
+func replayClient() *http.Client {
+	return &http.Client{Transport: &Replay{Dir: "testdata"}}
+}
+
+func date(year int, month time.Month, day int) *time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func TestOpenLibraryLookupISBN(t *testing.T) {
+	ol := &OpenLibrary{Client: replayClient()}
+	candidates, err := ol.Lookup(context.Background(), Query{ISBN: "978-0-261-10235-4"})
+	if err != nil { t.Fatal(err) }
+	if len(candidates) != 1 { t.Fatalf("got %d candidates, want 1", len(candidates)) }
+
+	c := candidates[0]
+	want := Candidate{
+		Source: "openlibrary",
+		Title: "The Fellowship of the Ring",
+		Authors: []string{"J.R.R. Tolkien"},
+		Publisher: "HarperCollins",
+		Published: date(1991, time.January, 1),
+		Tags: []string{"Fiction", "Fantasy", "Middle Earth (Imaginary place)", "Hobbits", "Wizards", "Elves", "Dwarves", "Quests (Expeditions)", "Rings", "Good and evil"},
+		Languages: []string{"eng"},
+		Identifiers: map[string]string{"isbn": "9780261102354", "openlibrary": "OL27513W"},
+		CoverURL: "https://covers.openlibrary.org/b/id/8474036-L.jpg",
+	}
+	if !reflect.DeepEqual(c, want) { t.Errorf("got %+v\nwant %+v", c, want) }
+}
+
+func TestOpenLibraryLookupTitle(t *testing.T) {
+	ol := &OpenLibrary{Client: replayClient()}
+	candidates, err := ol.Lookup(context.Background(), Query{Title: "The Left Hand of Darkness", Authors: []string{"Ursula K. Le Guin"}})
+	if err != nil { t.Fatal(err) }
+	if len(candidates) != 2 { t.Fatalf("got %d candidates, want 2", len(candidates)) }
+
+	first, second := candidates[0], candidates[1]
+	if !reflect.DeepEqual(first.Published, date(1969, time.January, 1)) { t.Errorf("first published %v, want the first publish year", first.Published) }
+	if first.Identifiers["isbn"] != "9780441478125" { t.Errorf("first isbn %q, want the ISBN-13", first.Identifiers["isbn"]) }
+	if first.Publisher != "" { t.Errorf("first publisher %q, want none", first.Publisher) }
+	if second.Title != "The Left Hand of Darkness: 50th Anniversary Edition" { t.Errorf("second title %q", second.Title) }
+	if !reflect.DeepEqual(second.Published, date(2019, time.October, 1)) { t.Errorf("second published %v", second.Published) }
+	if _, ok := second.Identifiers["isbn"]; ok { t.Errorf("second has isbn %q, want none", second.Identifiers["isbn"]) }
+	if second.CoverURL != "" { t.Errorf("second cover %q, want none", second.CoverURL) }
+}
+
+func TestGoogleBooksLookup(t *testing.T) {
+	// The key is not part of the recorded URL
+	gb := &GoogleBooks{Client: replayClient(), Key: "secret"}
+	candidates, err := gb.Lookup(context.Background(), Query{ISBN: "9780261102354"})
+	if err != nil { t.Fatal(err) }
+	if len(candidates) != 1 { t.Fatalf("got %d candidates, want 1", len(candidates)) }
+
+	c := candidates[0]
+	want := Candidate{
+		Source: "google",
+		Title: "The Fellowship Of The Ring: The Lord of the Rings, Part 1",
+		Authors: []string{"J.R.R. Tolkien"},
+		Publisher: "HarperCollins UK",
+		Published: date(2012, time.February, 15),
+		Description: "Continuing the story begun in The Hobbit.",
+		Tags: []string{"Fiction"},
+		Languages: []string{"en"},
+		Identifiers: map[string]string{"google": "aWZzLPhY4o0C", "isbn": "9780007488315"},
+		CoverURL: "https://books.google.com/books/content?id=aWZzLPhY4o0C&printsec=frontcover&img=1&zoom=1&source=gbs_api",
+	}
+	if !reflect.DeepEqual(c, want) { t.Errorf("got %+v\nwant %+v", c, want) }
+}
+
+func TestReplayMissingFixture(t *testing.T) {
+	ol := &OpenLibrary{Client: replayClient()}
+	_, err := ol.Lookup(context.Background(), Query{ISBN: "9780000000002"})
+	if err == nil || !strings.Contains(err.Error(), "no fixture") { t.Errorf("got error %v, want missing fixture", err) }
+}
+
+func TestRecorderReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"docs":[{"title":"Recorded","isbn":["9780261102354"]}]}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	recorded := &OpenLibrary{URL: server.URL, Client: &http.Client{Transport: &Recorder{Dir: dir}}}
+	want, err := recorded.Lookup(context.Background(), Query{ISBN: "9780261102354"})
+	if err != nil { t.Fatal(err) }
+	server.Close()
+
+	replayed := &OpenLibrary{URL: server.URL, Client: &http.Client{Transport: &Replay{Dir: dir}}}
+	got, err := replayed.Lookup(context.Background(), Query{ISBN: "9780261102354"})
+	if err != nil { t.Fatal(err) }
+	if !reflect.DeepEqual(got, want) { t.Errorf("replayed %+v, recorded %+v", got, want) }
+}
+
+func TestFileLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.json")
+	err := ioutil.WriteFile(path, []byte(`[
+		{"title": "The Dispossessed", "authors": ["Ursula K. Le Guin"], "identifiers": {"isbn": "978-0-06-051275-0"}},
+		{"title": "The Left Hand of Darkness", "authors": ["Ursula K. Le Guin"], "source": "curated"},
+		{"title": "The Lathe of Heaven", "authors": ["Ursula K. Le Guin"]}
+	]`), 0644)
+	if err != nil { t.Fatal(err) }
+	f := &File{Path: path}
+
+	tests := []struct {
+		name string
+		query Query
+		titles []string
+	}{
+		{"isbn", Query{ISBN: "9780060512750"}, []string{"The Dispossessed"}},
+		{"isbn ignores title", Query{ISBN: "9780060512750", Title: "Lathe"}, []string{"The Dispossessed"}},
+		{"title substring", Query{Title: "the l"}, []string{"The Left Hand of Darkness", "The Lathe of Heaven"}},
+		{"title and author", Query{Title: "heaven", Authors: []string{"le guin"}}, []string{"The Lathe of Heaven"}},
+		{"other author", Query{Title: "heaven", Authors: []string{"Tolkien"}}, []string{}},
+		{"empty", Query{}, []string{}},
+	}
+	for _, test := range tests {
+		candidates, err := f.Lookup(context.Background(), test.query)
+		if err != nil { t.Fatalf("%s: %v", test.name, err) }
+		titles := []string{}
+		for _, c := range candidates { titles = append(titles, c.Title) }
+		if !reflect.DeepEqual(titles, test.titles) { t.Errorf("%s: got %q, want %q", test.name, titles, test.titles) }
+	}
+
+	candidates, _ := f.Lookup(context.Background(), Query{Title: "darkness"})
+	if len(candidates) != 1 || candidates[0].Source != "curated" { t.Errorf("source of file entry was overwritten: %+v", candidates) }
+	candidates, _ = f.Lookup(context.Background(), Query{Title: "lathe"})
+	if len(candidates) != 1 || candidates[0].Source != "file" { t.Errorf("empty source not set: %+v", candidates) }
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in string
+		want *time.Time
+	}{
+		{"2001-05-02", date(2001, time.May, 2)},
+		{"2001-05", date(2001, time.May, 1)},
+		{"2001", date(2001, time.January, 1)},
+		{" 2001 ", date(2001, time.January, 1)},
+		{"May 2, 2001", date(2001, time.May, 2)},
+		{"Oct 2, 2001", date(2001, time.October, 2)},
+		{"May 2001", date(2001, time.May, 1)},
+		{"", nil},
+		{"circa 2001", nil},
+		{"2001-13-01", nil},
+	}
+	for _, test := range tests {
+		got := parseDate(test.in)
+		if !reflect.DeepEqual(got, test.want) { t.Errorf("parseDate(%q) = %v, want %v", test.in, got, test.want) }
+	}
+}
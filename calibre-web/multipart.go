@@ -0,0 +1,111 @@
+package calibre
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+type multipartPart struct {
+	header textproto.MIMEHeader
+	r io.Reader
+	size int64
+}
+
+// multipartBody is a multipart/form-data body that is streamed
+// while the request is sent instead of being buffered in memory
+type multipartBody struct {
+	boundary string
+	parts []multipartPart
+}
+
+func newMultipart() *multipartBody {
+	return &multipartBody{boundary: multipart.NewWriter(nil).Boundary()}
+}
+
+func (m *multipartBody) field(name, value string) {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(name)))
+	m.parts = append(m.parts, multipartPart{h, strings.NewReader(value), int64(len(value))})
+}
+
+// file adds a file part, size is -1 if unknown
+func (m *multipartBody) file(name, filename, contentType string, r io.Reader, size int64) {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(name), quoteEscaper.Replace(filename)))
+	if contentType == "" { contentType = "application/octet-stream" }
+	h.Set("Content-Type", contentType)
+	m.parts = append(m.parts, multipartPart{h, r, size})
+}
+
+func (m *multipartBody) contentType() string {
+	return "multipart/form-data; boundary=" + m.boundary
+}
+
+type countWriter int64
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	*c += countWriter(len(p))
+	return len(p), nil
+}
+
+// contentLength returns the size of the encoded body or -1 if any part has an unknown size
+func (m *multipartBody) contentLength() int64 {
+	var c countWriter
+	w := multipart.NewWriter(&c)
+	w.SetBoundary(m.boundary)
+
+	var total int64
+	for _, p := range m.parts {
+		if p.size < 0 { return -1 }
+		w.CreatePart(p.header)
+		total += p.size
+	}
+	w.Close()
+	return int64(c) + total
+}
+
+// reader encodes the parts into a pipe as it is read
+func (m *multipartBody) reader() io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		w := multipart.NewWriter(pw)
+		w.SetBoundary(m.boundary)
+		for _, p := range m.parts {
+			fw, err := w.CreatePart(p.header)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			n, err := io.Copy(fw, p.r)
+			if err == nil && p.size >= 0 && n != p.size {
+				err = fmt.Errorf("multipart: part is %d bytes, expected %d", n, p.size)
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(w.Close())
+	}()
+	return pr
+}
+
+func (api *API) postMultipart(ctx context.Context, url string, m *multipartBody) (*http.Response, error) {
+	body := m.reader()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	req.Header.Set("Content-Type", m.contentType())
+	req.ContentLength = m.contentLength()
+	return api.c.Do(req)
+}
@@ -0,0 +1,66 @@
+package calibre
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestMultipartBody(t *testing.T) {
+	cover := bytes.Repeat([]byte{0xff, 0xd8, 0x00}, 5000)
+	tests := []struct {
+		name string
+		size int64
+	}{
+		{"known size", int64(len(cover))},
+		{"unknown size", -1},
+	}
+	for _, test := range tests {
+		m := newMultipart()
+		m.field("title", "Mort")
+		m.field(`quo"ted`, "")
+		m.file("btn-upload", `cover "1".jpg`, "image/jpeg", iotest.HalfReader(bytes.NewReader(cover)), test.size)
+		m.file("btn-upload-format", "mort.epub", "", strings.NewReader("epub"), 4)
+
+		body, err := ioutil.ReadAll(m.reader())
+		if err != nil { t.Fatalf("%s: %v", test.name, err) }
+		length := m.contentLength()
+		if test.size < 0 && length != -1 { t.Errorf("%s: content length %d, want -1", test.name, length) }
+		if test.size >= 0 && length != int64(len(body)) { t.Errorf("%s: content length %d, %d bytes written", test.name, length, len(body)) }
+
+		mediatype, params, err := mime.ParseMediaType(m.contentType())
+		if err != nil || mediatype != "multipart/form-data" { t.Fatalf("%s: content type %q: %v", test.name, m.contentType(), err) }
+		want := []struct {
+			name, filename, contentType string
+			data []byte
+		}{
+			{"title", "", "", []byte("Mort")},
+			{`quo"ted`, "", "", []byte{}},
+			{"btn-upload", `cover "1".jpg`, "image/jpeg", cover},
+			{"btn-upload-format", "mort.epub", "application/octet-stream", []byte("epub")},
+		}
+		r := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for _, w := range want {
+			p, err := r.NextPart()
+			if err != nil { t.Fatalf("%s: part %s: %v", test.name, w.name, err) }
+			data, err := ioutil.ReadAll(p)
+			if err != nil { t.Fatal(err) }
+			if p.FormName() != w.name || p.FileName() != w.filename || p.Header.Get("Content-Type") != w.contentType || !bytes.Equal(data, w.data) {
+				t.Errorf("%s: part %q %q %q with %d bytes, want %+v", test.name, p.FormName(), p.FileName(), p.Header.Get("Content-Type"), len(data), w.name)
+			}
+		}
+		if _, err = r.NextPart(); err != io.EOF { t.Errorf("%s: after the last part: %v", test.name, err) }
+	}
+}
+
+func TestMultipartBodyShortPart(t *testing.T) {
+	m := newMultipart()
+	m.file("btn-upload", "mort.epub", "", strings.NewReader("epub"), 10)
+	_, err := ioutil.ReadAll(m.reader())
+	if err == nil { t.Error("part shorter than its size was sent") }
+}
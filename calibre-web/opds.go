@@ -0,0 +1,214 @@
+package calibre
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/yrhki/gocalibre/calibre-web/opds"
+)
+
+// UseOPDS makes ListBooks, Search and downloads use the OPDS catalog instead
+// of scraping HTML. OPDS needs the credentials for HTTP Basic auth.
+func (api *API) UseOPDS(username, password string) error {
+	c, err := opds.NewClient(api.url + "/opds", username, password, api.c)
+	if err != nil { return err }
+	api.opds = c
+	return nil
+}
+
+// OPDS returns the catalog client set by UseOPDS or nil
+func (api *API) OPDS() *opds.Client { return api.opds }
+
+// listBookFromEntry converts an acquisition entry to a ListBook
+func listBookFromEntry(e *opds.Entry) (*ListBook, bool) {
+	id, ok := e.BookID()
+	if !ok { return nil, false }
+	authors := []Author{}
+	for _, a := range e.Authors {
+		author := Author{name: a.Name}
+		if a.URI != "" {
+			author.id, _ = strconv.ParseUint(path.Base(a.URI), 10, 0)
+		}
+		authors = append(authors, author)
+	}
+	return &ListBook{id: id, name: e.Title, authors: authors}, true
+}
+
+// opdsBooks loads all pages of a catalog feed and returns its books
+func (api *API) opdsBooks(ctx context.Context, href string) ([]*ListBook, error) {
+	entries, err := api.opds.Entries(ctx, href)
+	if err != nil { return nil, err }
+	books := []*ListBook{}
+	for _, e := range entries {
+		if book, ok := listBookFromEntry(e); ok { books = append(books, book) }
+	}
+	return books, nil
+}
+
+// Search returns the books matching query in title, authors, tags and series
+func (api *API) Search(ctx context.Context, query string) ([]*ListBook, error) {
+	if api.opds != nil {
+		entries, err := api.opds.Search(ctx, query)
+		if err != nil { return nil, err }
+		books := []*ListBook{}
+		for _, e := range entries {
+			if book, ok := listBookFromEntry(e); ok { books = append(books, book) }
+		}
+		return books, nil
+	}
+
+	resp, err := api.get(ctx, api.url + "/search?query=" + url.QueryEscape(query))
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil { return nil, err }
+	return parseBookList(doc), nil
+}
+
+// downloadResponse requests a format from the web download or the OPDS catalog
+func (api *API) downloadResponse(ctx context.Context, id uint64, format Format) (*http.Response, error) {
+	if api.opds == nil {
+		resp, err := api.get(ctx, api.url + downloadFormat(id, format))
+		if err != nil { return nil, err }
+		if resp.StatusCode == 404 {
+			resp.Body.Close()
+			return nil, ErrNotFound
+		}
+		return resp, nil
+	}
+
+	resp, err := api.opds.Get(ctx, fmt.Sprintf("download/%d/%s/", id, format.Ext()))
+	var status *opds.StatusError
+	if errors.As(err, &status) && status.StatusCode == 404 { return nil, ErrNotFound }
+	return resp, err
+}
+
+// entryFormat returns the format of an acquisition link from its path or type
+func entryFormat(l opds.Link) (Format, bool) {
+	parts := strings.Split(strings.Trim(path.Clean(l.Href), "/"), "/")
+	for i, p := range parts {
+		if p == "download" && i + 2 < len(parts) {
+			if format, ok := FormatFromExt(parts[i+2]); ok { return format, true }
+		}
+	}
+	if format, ok := FormatFromExt(path.Ext(path.Clean(l.Href))); ok { return format, true }
+	t := strings.TrimSpace(strings.Split(l.Type, ";")[0])
+	for _, format := range Formats {
+		if t != "" && format.ContentType() == t { return format, true }
+	}
+	return 0, false
+}
+
+// parseIssued parses dc:issued, which is a full timestamp or only a date or year
+func parseIssued(s string) (*time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil { return &t, true }
+	}
+	return nil, false
+}
+
+// identifierPrefixes are the URN and scheme prefixes of dc:identifier values
+var identifierPrefixes = []string{"urn:isbn:", "urn:issn:", "urn:doi:", "isbn:", "issn:", "doi:"}
+
+// parseIdentifier splits a dc:identifier like urn:isbn:123 into type and value
+func parseIdentifier(s string) (string, string, bool) {
+	lower := strings.ToLower(s)
+	for _, prefix := range identifierPrefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return strings.Trim(strings.TrimPrefix(prefix, "urn:"), ":"), s[len(prefix):], true
+		}
+	}
+	// calibre writes other identifiers as urn:type:value
+	if strings.HasPrefix(lower, "urn:") {
+		sp := strings.SplitN(s[4:], ":", 2)
+		if len(sp) == 2 && strings.ToLower(sp[0]) != "uuid" { return strings.ToLower(sp[0]), sp[1], true }
+	}
+	return "", "", false
+}
+
+// BookFromEntry converts an OPDS acquisition entry to a Book. OPDS has no read
+// state, and the description is the summary, which calibre-web strips of HTML.
+func BookFromEntry(e *opds.Entry) (*Book, error) {
+	id, ok := e.BookID()
+	if !ok { return nil, fmt.Errorf("opds entry %q has no book id", e.ID) }
+
+	book := &Book{
+		id: id,
+		formats: make(map[Format]bool),
+		sizes: make(map[Format]int64),
+		acquisitions: make(map[Format]string),
+		Title: strings.TrimSpace(e.Title),
+		Authors: []string{},
+		Categories: []string{},
+		Publisher: e.PublisherName(),
+		Languages: e.Languages,
+		Identifiers: make(BookIdentifiers),
+		Series: e.Series,
+	}
+	for _, a := range e.Authors { book.Authors = append(book.Authors, a.Name) }
+	for _, c := range e.Categories {
+		if c.Label != "" {
+			book.Categories = append(book.Categories, c.Label)
+		} else {
+			book.Categories = append(book.Categories, c.Term)
+		}
+	}
+
+	book.Description = strings.TrimSpace(e.Summary)
+	if e.Content != nil && strings.TrimSpace(e.Content.Body) != "" { book.Description = strings.TrimSpace(e.Content.Body) }
+
+	if t, ok := parseIssued(e.Issued); ok { book.Published = t }
+	if e.SeriesIndex != "" {
+		index, err := strconv.ParseFloat(e.SeriesIndex, 64)
+		if err != nil { return nil, fmt.Errorf("opds entry %q: series index: %w", e.ID, err) }
+		book.SeriesIndex = index
+	}
+	// calibre ratings are 0-10 for half stars
+	if e.Rating != "" {
+		rating, err := strconv.ParseFloat(e.Rating, 64)
+		if err == nil { book.Rating = uint8(rating / 2) }
+	}
+
+	for _, identifier := range e.Identifiers {
+		if t, v, ok := parseIdentifier(identifier); ok { book.Identifiers[t] = v }
+	}
+
+	for _, l := range e.Acquisitions() {
+		format, ok := entryFormat(l)
+		if !ok { continue }
+		book.formats[format] = true
+		book.acquisitions[format] = l.Href
+		if l.Length > 0 { book.sizes[format] = l.Length }
+	}
+	return book, nil
+}
+
+// opdsBook finds the entry of a book in the catalog. It has no lookup by
+// id, so the book is searched by title and all books are only walked if
+// the search does not find it.
+func (api *API) opdsBook(ctx context.Context, id uint64, title string) (*Book, error) {
+	if title != "" {
+		entries, err := api.opds.Search(ctx, title)
+		if err != nil && !errors.Is(err, opds.ErrNoSearch) { return nil, err }
+		for _, e := range entries {
+			if eid, ok := e.BookID(); ok && eid == id { return BookFromEntry(e) }
+		}
+	}
+
+	feed, err := api.opds.Feed(ctx, "new")
+	for ; feed != nil && err == nil; feed, err = api.opds.Next(ctx, feed) {
+		for _, e := range feed.Entries {
+			if eid, ok := e.BookID(); ok && eid == id { return BookFromEntry(e) }
+		}
+	}
+	if err != nil { return nil, err }
+	return nil, ErrBookNotFound
+}
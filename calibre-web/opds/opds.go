@@ -0,0 +1,328 @@
+// Package opds is a client for the OPDS 1.2 catalog of calibre-web
+package opds
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	NSAtom = "http://www.w3.org/2005/Atom"
+	NSDC = "http://purl.org/dc/terms/"
+	NSOpenSearch = "http://a9.com/-/spec/opensearch/1.1/"
+	NSOPDS = "http://opds-spec.org/2010/catalog"
+	NSCalibre = "http://calibre.kovidgoyal.net/2009/metadata"
+
+	RelAcquisition = "http://opds-spec.org/acquisition"
+	RelImage = "http://opds-spec.org/image"
+	RelThumbnail = "http://opds-spec.org/image/thumbnail"
+	RelNext = "next"
+	RelSearch = "search"
+
+	TypeAtom = "application/atom+xml"
+	TypeOpenSearch = "application/opensearchdescription+xml"
+)
+
+var (
+	ErrUnauthorized = errors.New("opds: unauthorized")
+	ErrNoSearch = errors.New("opds: catalog has no search")
+)
+
+// StatusError is returned for responses other than 200 and 401
+type StatusError struct {
+	URL string
+	StatusCode int
+	Status string
+}
+
+func (e *StatusError) Error() string { return fmt.Sprintf("opds: %s: %s", e.URL, e.Status) }
+
+type Link struct {
+	Rel string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+	Length int64 `xml:"length,attr,omitempty"`
+}
+
+// IsAcquisition reports whether the link downloads a book, which includes
+// the open-access, borrow and buy variants of the acquisition relation
+func (l Link) IsAcquisition() bool { return strings.HasPrefix(l.Rel, RelAcquisition) }
+
+// IsNavigation reports whether the link leads to another catalog feed
+func (l Link) IsNavigation() bool { return strings.HasPrefix(l.Type, TypeAtom) }
+
+type Person struct {
+	Name string `xml:"name"`
+	URI string `xml:"uri,omitempty"`
+}
+
+type Category struct {
+	Scheme string `xml:"scheme,attr,omitempty"`
+	Term string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+type Content struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",innerxml"`
+}
+
+type Entry struct {
+	ID string `xml:"id"`
+	Title string `xml:"title"`
+	Updated string `xml:"updated"`
+	Authors []Person `xml:"author"`
+	Categories []Category `xml:"category"`
+	Summary string `xml:"summary,omitempty"`
+	Content *Content `xml:"content"`
+	Links []Link `xml:"link"`
+
+	// Dublin Core metadata of acquisition entries
+	Languages []string `xml:"http://purl.org/dc/terms/ language"`
+	Issued string `xml:"http://purl.org/dc/terms/ issued,omitempty"`
+	Identifiers []string `xml:"http://purl.org/dc/terms/ identifier"`
+	DCPublisher string `xml:"http://purl.org/dc/terms/ publisher,omitempty"`
+	// Publisher is the atom style publisher calibre-web writes
+	Publisher *Person `xml:"publisher"`
+
+	// Series of the calibre metadata namespace
+	Series string `xml:"http://calibre.kovidgoyal.net/2009/metadata series,omitempty"`
+	SeriesIndex string `xml:"http://calibre.kovidgoyal.net/2009/metadata series_index,omitempty"`
+	Rating string `xml:"http://calibre.kovidgoyal.net/2009/metadata rating,omitempty"`
+}
+
+// PublisherName returns the Dublin Core or atom style publisher
+func (e *Entry) PublisherName() string {
+	if e.DCPublisher != "" { return e.DCPublisher }
+	if e.Publisher != nil { return e.Publisher.Name }
+	return ""
+}
+
+// Link returns the first link with rel
+func (e *Entry) Link(rel string) (Link, bool) { return findLink(e.Links, rel) }
+
+// Acquisitions returns the download links of an entry
+func (e *Entry) Acquisitions() []Link {
+	links := []Link{}
+	for _, l := range e.Links {
+		if l.IsAcquisition() { links = append(links, l) }
+	}
+	return links
+}
+
+// IsNavigation reports whether the entry leads to another feed instead of a book
+func (e *Entry) IsNavigation() bool { return len(e.Acquisitions()) == 0 }
+
+// BookID parses the calibre-web book id from the acquisition or cover links
+func (e *Entry) BookID() (uint64, bool) {
+	for _, l := range e.Links {
+		if !l.IsAcquisition() && !strings.HasPrefix(l.Rel, RelImage) { continue }
+		parts := strings.Split(strings.Trim(path.Clean(hrefPath(l.Href)), "/"), "/")
+		for i, p := range parts {
+			if (p == "download" || p == "cover") && i + 1 < len(parts) {
+				if id, err := strconv.ParseUint(parts[i+1], 10, 64); err == nil { return id, true }
+			}
+		}
+	}
+	return 0, false
+}
+
+func hrefPath(href string) string {
+	u, err := url.Parse(href)
+	if err != nil { return href }
+	return u.Path
+}
+
+type Feed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	ID string `xml:"id"`
+	Title string `xml:"title"`
+	Updated string `xml:"updated"`
+	Links []Link `xml:"link"`
+	Entries []*Entry `xml:"entry"`
+
+	TotalResults int `xml:"http://a9.com/-/spec/opensearch/1.1/ totalResults,omitempty"`
+	ItemsPerPage int `xml:"http://a9.com/-/spec/opensearch/1.1/ itemsPerPage,omitempty"`
+	StartIndex int `xml:"http://a9.com/-/spec/opensearch/1.1/ startIndex,omitempty"`
+
+	// base is the URL the feed was loaded from, links are relative to it
+	base *url.URL
+}
+
+// Link returns the first link with rel
+func (f *Feed) Link(rel string) (Link, bool) { return findLink(f.Links, rel) }
+
+func findLink(links []Link, rel string) (Link, bool) {
+	for _, l := range links {
+		if l.Rel == rel { return l, true }
+	}
+	return Link{}, false
+}
+
+// Parse decodes an Atom feed, base is used to resolve relative links
+func Parse(r io.Reader, base *url.URL) (*Feed, error) {
+	feed := new(Feed)
+	err := xml.NewDecoder(r).Decode(feed)
+	if err != nil { return nil, err }
+	feed.base = base
+	return feed, nil
+}
+
+// OpenSearchDescription describes the search of a catalog
+type OpenSearchDescription struct {
+	XMLName xml.Name `xml:"OpenSearchDescription"`
+	// NS is only set to write the description
+	NS string `xml:"xmlns,attr,omitempty"`
+	ShortName string `xml:"ShortName"`
+	Description string `xml:"Description"`
+	URLs []OpenSearchURL `xml:"Url"`
+}
+
+type OpenSearchURL struct {
+	Type string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// Template returns the URL template for Atom results
+func (osd *OpenSearchDescription) Template() (string, bool) {
+	for _, u := range osd.URLs {
+		if strings.HasPrefix(u.Type, TypeAtom) { return u.Template, true }
+	}
+	if len(osd.URLs) > 0 { return osd.URLs[0].Template, true }
+	return "", false
+}
+
+// Client reads a catalog with HTTP Basic auth, which is the only
+// authentication calibre-web accepts for OPDS
+type Client struct {
+	root *url.URL
+	username, password string
+	c *http.Client
+}
+
+// NewClient creates a client for the catalog at root, usually the
+// calibre-web URL followed by /opds. A nil c uses http.DefaultClient.
+// Hrefs given to the client are relative to root.
+func NewClient(root, username, password string, c *http.Client) (*Client, error) {
+	// Relative hrefs like "new" are below the root
+	u, err := url.Parse(strings.TrimSuffix(root, "/") + "/")
+	if err != nil { return nil, err }
+	if c == nil { c = http.DefaultClient }
+	return &Client{root: u, username: username, password: password, c: c}, nil
+}
+
+// resolve makes href absolute, relative hrefs are resolved against base or the root
+func (c *Client) resolve(base *url.URL, href string) (string, error) {
+	if base == nil { base = c.root }
+	u, err := url.Parse(href)
+	if err != nil { return "", err }
+	return base.ResolveReference(u).String(), nil
+}
+
+// Get requests href with the credentials of the client. Non 200 responses are returned as errors.
+func (c *Client) Get(ctx context.Context, href string) (*http.Response, error) {
+	u, err := c.resolve(nil, href)
+	if err != nil { return nil, err }
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil { return nil, err }
+	if c.username != "" { req.SetBasicAuth(c.username, c.password) }
+
+	resp, err := c.c.Do(req)
+	if err != nil { return nil, err }
+	switch resp.StatusCode {
+	case 200:
+		return resp, nil
+	case 401:
+		resp.Body.Close()
+		return nil, ErrUnauthorized
+	default:
+		resp.Body.Close()
+		return nil, &StatusError{URL: u, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+}
+
+// Feed loads a feed, an empty href loads the root feed
+func (c *Client) Feed(ctx context.Context, href string) (*Feed, error) {
+	if href == "" { href = c.root.String() }
+	resp, err := c.Get(ctx, href)
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	return Parse(resp.Body, resp.Request.URL)
+}
+
+// Next loads the next page of feed, it returns nil at the last page
+func (c *Client) Next(ctx context.Context, feed *Feed) (*Feed, error) {
+	next, ok := feed.Link(RelNext)
+	if !ok { return nil, nil }
+	href, err := c.resolve(feed.base, next.Href)
+	if err != nil { return nil, err }
+	return c.Feed(ctx, href)
+}
+
+// Entries loads the entries of all pages of a feed
+func (c *Client) Entries(ctx context.Context, href string) ([]*Entry, error) {
+	entries := []*Entry{}
+	feed, err := c.Feed(ctx, href)
+	for ; feed != nil && err == nil; feed, err = c.Next(ctx, feed) {
+		entries = append(entries, feed.Entries...)
+	}
+	if err != nil { return nil, err }
+	return entries, nil
+}
+
+// OpenSearch loads the OpenSearch description linked from the root feed
+func (c *Client) OpenSearch(ctx context.Context) (*OpenSearchDescription, error) {
+	root, err := c.Feed(ctx, "")
+	if err != nil { return nil, err }
+	link, ok := root.Link(RelSearch)
+	if !ok { return nil, ErrNoSearch }
+	href, err := c.resolve(root.base, link.Href)
+	if err != nil { return nil, err }
+
+	resp, err := c.Get(ctx, href)
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	osd := new(OpenSearchDescription)
+	err = xml.NewDecoder(resp.Body).Decode(osd)
+	if err != nil { return nil, err }
+	return osd, nil
+}
+
+// Search returns the entries of all result pages of query
+func (c *Client) Search(ctx context.Context, query string) ([]*Entry, error) {
+	osd, err := c.OpenSearch(ctx)
+	if err != nil { return nil, err }
+	template, ok := osd.Template()
+	if !ok { return nil, ErrNoSearch }
+	return c.Entries(ctx, expandTemplate(template, query))
+}
+
+// expandTemplate fills the search terms of an OpenSearch template and drops optional parameters
+func expandTemplate(template, query string) string {
+	i := strings.Index(template, "{searchTerms}")
+	if i < 0 { return template }
+	terms := url.PathEscape(query)
+	if strings.Contains(template[:i], "?") { terms = url.QueryEscape(query) }
+	template = template[:i] + terms + template[i+len("{searchTerms}"):]
+
+	for {
+		start := strings.Index(template, "{")
+		end := strings.Index(template, "?}")
+		if start < 0 || end < start { return template }
+		template = template[:start] + template[end+2:]
+	}
+}
+
+// Download opens an acquisition link
+func (c *Client) Download(ctx context.Context, link Link) (*http.Response, error) {
+	return c.Get(ctx, link.Href)
+}
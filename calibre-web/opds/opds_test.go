@@ -0,0 +1,113 @@
+package opds
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	tests := []struct {
+		template, query, want string
+	}{
+		{"/opds/search/{searchTerms}", "Terry Pratchett", "/opds/search/Terry%20Pratchett"},
+		{"/opds/search/{searchTerms}/", "AC/DC?", "/opds/search/AC%2FDC%3F/"},
+		{"/opds/search?query={searchTerms}", "Terry Pratchett & co", "/opds/search?query=Terry+Pratchett+%26+co"},
+		{"/opds/search?query={searchTerms}&page={startPage?}", "mort", "/opds/search?query=mort&page="},
+		{"/opds/search?query={searchTerms}&lang={language?}&count={count?}", "mort", "/opds/search?query=mort&lang=&count="},
+		{"/opds/search?query={searchTerms}", "{count?}", "/opds/search?query=%7Bcount%3F%7D"},
+		{"/opds/search?start={startIndex?}&q={searchTerms}", "mort", "/opds/search?start=&q=mort"},
+		{"/opds/new", "mort", "/opds/new"},
+	}
+	for _, test := range tests {
+		if got := expandTemplate(test.template, test.query); got != test.want {
+			t.Errorf("%q with %q: %q, want %q", test.template, test.query, got, test.want)
+		}
+	}
+}
+
+func TestEntryBookID(t *testing.T) {
+	tests := []struct {
+		name string
+		links []Link
+		id uint64
+		ok bool
+	}{
+		{"acquisition", []Link{{Rel: RelAcquisition, Href: "/opds/download/12/epub/"}}, 12, true},
+		{"open access", []Link{{Rel: RelAcquisition + "/open-access", Href: "http://example.com/calibre/opds/download/7/pdf/"}}, 7, true},
+		{"cover", []Link{{Rel: RelImage, Href: "/opds/cover/3"}}, 3, true},
+		{"thumbnail", []Link{{Rel: RelThumbnail, Href: "/opds/cover/4?size=sm"}}, 4, true},
+		{"navigation", []Link{{Rel: "subsection", Href: "/opds/author/5", Type: TypeAtom}}, 0, false},
+		{"not a number", []Link{{Rel: RelAcquisition, Href: "/opds/download/latest/epub/"}}, 0, false},
+		{"no links", nil, 0, false},
+	}
+	for _, test := range tests {
+		e := &Entry{Links: test.links}
+		id, ok := e.BookID()
+		if id != test.id || ok != test.ok { t.Errorf("%s: %d %v, want %d %v", test.name, id, ok, test.id, test.ok) }
+	}
+}
+
+const testFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <id>urn:uuid:2853dacf-ed79-42f5-8e8a-a7bb3d1ae6a2</id>
+  <title>New Books</title>
+  %s
+  <entry>
+    <title>%s</title>
+    <id>urn:uuid:%[2]s</id>
+    <link rel="http://opds-spec.org/acquisition" href="/calibre/opds/download/1/epub/" type="application/epub+zip"/>
+  </entry>
+</feed>`
+
+func TestClientPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "admin123" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Login Required"`)
+			w.WriteHeader(401)
+			return
+		}
+		switch r.URL.RequestURI() {
+		case "/calibre/opds/new":
+			// Relative to the feed, not to the server
+			fmt.Fprintf(w, testFeed, `<link rel="next" href="new?offset=1" type="application/atom+xml"/>`, "Mort")
+		case "/calibre/opds/new?offset=1":
+			fmt.Fprintf(w, testFeed, `<link rel="next" href="/calibre/opds/new?offset=2" type="application/atom+xml"/>`, "Sourcery")
+		case "/calibre/opds/new?offset=2":
+			fmt.Fprintf(w, testFeed, "", "Eric")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name, root, password string
+		want []string
+		err error
+	}{
+		{"pages", server.URL + "/calibre/opds", "admin123", []string{"Mort", "Sourcery", "Eric"}, nil},
+		{"trailing slash", server.URL + "/calibre/opds/", "admin123", []string{"Mort", "Sourcery", "Eric"}, nil},
+		{"wrong password", server.URL + "/calibre/opds", "wrong", nil, ErrUnauthorized},
+	}
+	for _, test := range tests {
+		c, err := NewClient(test.root, "admin", test.password, server.Client())
+		if err != nil { t.Fatal(err) }
+		entries, err := c.Entries(context.Background(), "new")
+		if err != test.err { t.Errorf("%s: error %v, want %v", test.name, err, test.err) }
+		if len(entries) != len(test.want) {
+			t.Errorf("%s: %d entries, want %v", test.name, len(entries), test.want)
+			continue
+		}
+		for i, e := range entries {
+			if e.Title != test.want[i] { t.Errorf("%s: entry %d is %q, want %q", test.name, i, e.Title, test.want[i]) }
+		}
+	}
+
+	c, err := NewClient(server.URL + "/calibre/opds", "admin", "admin123", server.Client())
+	if err != nil { t.Fatal(err) }
+	_, err = c.Feed(context.Background(), "missing")
+	if se, ok := err.(*StatusError); !ok || se.StatusCode != 404 { t.Errorf("missing feed: %v", err) }
+}
@@ -0,0 +1,93 @@
+package calibre
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/yrhki/gocalibre/calibre-web/library"
+)
+
+const testOPF = `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+<dc:identifier opf:scheme="calibre">%d</dc:identifier>
+<dc:title>%s</dc:title>
+<dc:creator opf:role="aut">Terry Pratchett</dc:creator>
+</metadata>
+</package>`
+
+// opdsServer serves book pages that can't be parsed and a catalog of the
+// books in titles, it counts the requests of the full book list
+func opdsServer(t *testing.T, titles map[uint64]string) (*API, *int32) {
+	dir := t.TempDir()
+	for id, title := range titles {
+		bookDir := filepath.Join(dir, "Terry Pratchett", fmt.Sprintf("%s (%d)", title, id))
+		if err := os.MkdirAll(bookDir, 0755); err != nil { t.Fatal(err) }
+		if err := ioutil.WriteFile(filepath.Join(bookDir, "metadata.opf"), []byte(fmt.Sprintf(testOPF, id, title)), 0644); err != nil { t.Fatal(err) }
+		if err := ioutil.WriteFile(filepath.Join(bookDir, "book.epub"), []byte("epub"), 0644); err != nil { t.Fatal(err) }
+	}
+	lib, err := library.Open(dir)
+	if err != nil { t.Fatal(err) }
+	catalog := library.NewServer(lib, "Test")
+	catalog.PageSize = 1
+
+	var walked int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/opds") {
+			if strings.HasPrefix(r.URL.Path, "/opds/new") { atomic.AddInt32(&walked, 1) }
+			catalog.ServeHTTP(w, r)
+			return
+		}
+		var id uint64
+		if _, err := fmt.Sscanf(r.URL.Path, "/book/%d", &id); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		// A template the selectors don't match
+		fmt.Fprintf(w, `<html><head><title>Calibre-Web | %s</title></head><body><h1>%s</h1></body></html>`, titles[id], titles[id])
+	}))
+	t.Cleanup(server.Close)
+
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+	if err = api.UseOPDS("", ""); err != nil { t.Fatal(err) }
+	return api, &walked
+}
+
+func TestBookByIDOPDSFallback(t *testing.T) {
+	api, walked := opdsServer(t, map[uint64]string{1: "Mort", 2: "Guards Guards", 3: "Small Gods"})
+
+	book, err := api.BookByID(2)
+	if err != nil { t.Fatal(err) }
+	if book.ID() != 2 || book.Title != "Guards Guards" || !book.HasFormat(FormatEPUB) { t.Errorf("got %+v", book) }
+	if *walked != 0 { t.Errorf("walked the catalog %d times although search finds the book", *walked) }
+
+	if _, err = api.BookByID(4); err == nil { t.Error("found a book that is not in the catalog") }
+	if *walked == 0 { t.Error("book without title was not looked up in the catalog") }
+}
+
+func TestParseBookPageErrors(t *testing.T) {
+	api, err := NewAPI("")
+	if err != nil { t.Fatal(err) }
+	pages := map[string]string{
+		"no title": `<p class="author"><a href="/author/1">Terry Pratchett</a></p>`,
+		"author without link": `<h2 id="title">Mort</h2><p class="author"><a>Terry Pratchett</a></p>`,
+		"short date": `<h2 id="title">Mort</h2><div class="publishing-date"><p>1987</p></div>`,
+		"series": `<h2 id="title">Mort</h2><p>Discworld</p>`,
+		"languages": `<h2 id="title">Mort</h2><div class="languages"><span>en</span></div>`,
+	}
+	for name, page := range pages {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+		if err != nil { t.Fatal(err) }
+		_, err = api.parseBookPage(doc, 1)
+		if err == nil || !strings.HasPrefix(err.Error(), "book 1: parsing page: ") { t.Errorf("%s: got error %v", name, err) }
+	}
+}
@@ -0,0 +1,145 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/ioprogress"
+)
+
+// Reporter receives the progress of transfers identified by name.
+// total is -1 if the size is unknown.
+type Reporter interface {
+	Progress(name string, progress, total int64)
+	Done(name string)
+}
+
+// Func reports progress to a function and ignores Done
+type Func func(name string, progress, total int64)
+
+func (f Func) Progress(name string, progress, total int64) { f(name, progress, total) }
+func (f Func) Done(name string) {}
+
+// Silent discards all progress
+var Silent Reporter = Func(func(string, int64, int64) {})
+
+// Reader reports the progress of reading r to rep, a nil rep reports nothing
+func Reader(r io.Reader, name string, size int64, rep Reporter) io.Reader {
+	if rep == nil { return r }
+	return &ioprogress.Reader{
+		Reader: r,
+		Size: size,
+		DrawFunc: func(progress, total int64) error {
+			if progress == -1 && total == -1 {
+				rep.Done(name)
+			} else {
+				rep.Progress(name, progress, total)
+			}
+			return nil
+		},
+	}
+}
+
+func line(name string, progress, total int64) string {
+	return fmt.Sprintf("[%s]: %s", ioprogress.DrawTextFormatBytes(progress, total), name)
+}
+
+type terminal struct {
+	mu sync.Mutex
+	w io.Writer
+}
+
+// Terminal draws a single progress line to w, which is
+// overwritten on each update. Use Multi for concurrent transfers.
+func Terminal(w io.Writer) Reporter { return &terminal{w: w} }
+
+func (t *terminal) Progress(name string, progress, total int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "\r\033[2K%s", line(name, progress, total))
+}
+
+func (t *terminal) Done(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintln(t.w)
+}
+
+// Multi draws one line per active transfer to a terminal.
+// Finished transfers are printed once above the active ones.
+type Multi struct {
+	mu sync.Mutex
+	w io.Writer
+	names []string
+	lines map[string]string
+	drawn int
+}
+
+func NewMulti(w io.Writer) *Multi { return &Multi{w: w, lines: map[string]string{}} }
+
+func (m *Multi) Progress(name string, progress, total int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.lines[name]; !ok { m.names = append(m.names, name) }
+	m.lines[name] = line(name, progress, total)
+	m.redraw("")
+}
+
+func (m *Multi) Done(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	finished, ok := m.lines[name]
+	if !ok { return }
+	delete(m.lines, name)
+	for i, n := range m.names {
+		if n == name {
+			m.names = append(m.names[:i], m.names[i+1:]...)
+			break
+		}
+	}
+	m.redraw(finished)
+}
+
+// Println prints a line above the progress lines
+func (m *Multi) Println(a ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.redraw(strings.TrimSuffix(fmt.Sprintln(a...), "\n"))
+}
+
+// Fprintln prints a line to w, like errors to stderr. The progress lines are
+// cleared first and drawn again below the line.
+func (m *Multi) Fprintln(w io.Writer, a ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.drawn > 0 {
+		fmt.Fprintf(m.w, "\033[%dA", m.drawn)
+		for i := 0; i < m.drawn; i++ { fmt.Fprint(m.w, "\033[2K\n") }
+		fmt.Fprintf(m.w, "\033[%dA", m.drawn)
+		m.drawn = 0
+	}
+	fmt.Fprintln(w, a...)
+	m.redraw("")
+}
+
+func (m *Multi) redraw(finished string) {
+	if m.drawn > 0 { fmt.Fprintf(m.w, "\033[%dA", m.drawn) }
+	written := 0
+	if finished != "" {
+		fmt.Fprintf(m.w, "\033[2K%s\n", finished)
+		written++
+	}
+	for _, name := range m.names {
+		fmt.Fprintf(m.w, "\033[2K%s\n", m.lines[name])
+		written++
+	}
+
+	// Clear lines left over from transfers that finished
+	if extra := m.drawn - written; extra > 0 {
+		for i := 0; i < extra; i++ { fmt.Fprint(m.w, "\033[2K\n") }
+		fmt.Fprintf(m.w, "\033[%dA", extra)
+	}
+	m.drawn = len(m.names)
+}
@@ -0,0 +1,17 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMultiFprintln(t *testing.T) {
+	var out, errs bytes.Buffer
+	m := NewMulti(&out)
+	m.Progress("mort.epub", 1, 2)
+	m.Fprintln(&errs, "Failed:", "mort")
+	if errs.String() != "Failed: mort\n" { t.Errorf("printed %q", errs.String()) }
+	if strings.Contains(out.String(), "Failed") { t.Errorf("progress output has the message: %q", out.String()) }
+	if strings.Count(out.String(), "mort.epub") != 2 { t.Errorf("progress line not drawn again: %q", out.String()) }
+}
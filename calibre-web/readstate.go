@@ -0,0 +1,42 @@
+package calibre
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func (api *API) toggle(endpoint string, id uint64) error {
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/ajax/%s/%d", api.url, endpoint, id), nil)
+	if err != nil { return err }
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	resp, err := api.c.Do(req)
+	if err != nil { return err }
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK { return fmt.Errorf("%s %d: %s", endpoint, id, resp.Status) }
+	return nil
+}
+
+// MarkRead sets the read status of a book for the current user
+func (api *API) MarkRead(id uint64, read bool) error {
+	book, err := api.BookByID(id)
+	if err != nil { return err }
+	if book.read == read { return nil }
+	return api.toggle("toggleread", id)
+}
+
+// SetArchived archives or unarchives a book for the current user, books
+// that already are are left alone
+func (api *API) SetArchived(id uint64, archived bool) error {
+	book, err := api.BookByID(id)
+	if err != nil { return err }
+	if book.archived == archived { return nil }
+	return api.toggle("togglearchived", id)
+}
+
+// ToggleArchived archives or unarchives a book for the current user
+func (api *API) ToggleArchived(id uint64) error { return api.toggle("togglearchived", id) }
+
+func (api *API) ReadBooks() ([]*ListBook, error) { return api.listBooks("read") }
+func (api *API) UnreadBooks() ([]*ListBook, error) { return api.listBooks("unread") }
+func (api *API) ArchivedBooks() ([]*ListBook, error) { return api.listBooks("archived") }
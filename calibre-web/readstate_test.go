@@ -0,0 +1,61 @@
+package calibre
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testStatePage is a book page with the read and archived checkboxes
+const testStatePage = `<html><body><div class="single">
+<h2 id="title">Mort</h2>
+<p class="author"><a href="/author/1">Terry Pratchett</a></p>
+<label class="block" for="have_read_cb"><input id="have_read_cb" data-checked="Mark As Unread" data-unchecked="Mark As Read" type="checkbox" %s><span>Read</span></label>
+<label class="block" for="archived_cb"><input id="archived_cb" data-checked="Restore from archive" data-unchecked="Add to archive" type="checkbox" %s><span>Archived</span></label>
+</div></body></html>`
+
+func TestReadState(t *testing.T) {
+	state := map[string]bool{}
+	toggles := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checked := func(name string) string {
+			if state[name] { return "checked" }
+			return ""
+		}
+		switch {
+		case r.URL.Path == "/book/1":
+			fmt.Fprintf(w, testStatePage, checked("toggleread"), checked("togglearchived"))
+		case strings.HasPrefix(r.URL.Path, "/ajax/toggle") && strings.HasSuffix(r.URL.Path, "/1") && r.Method == http.MethodPost:
+			name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/ajax/"), "/1")
+			state[name] = !state[name]
+			toggles = append(toggles, name)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+
+	steps := []func() error{
+		func() error { return api.MarkRead(1, true) },
+		func() error { return api.MarkRead(1, true) },
+		func() error { return api.SetArchived(1, true) },
+		func() error { return api.SetArchived(1, true) },
+		func() error { return api.SetArchived(1, false) },
+		func() error { return api.MarkRead(1, false) },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil { t.Fatalf("step %d: %v", i, err) }
+	}
+	want := []string{"toggleread", "togglearchived", "togglearchived", "toggleread"}
+	if !reflect.DeepEqual(toggles, want) { t.Errorf("toggled %q, want %q", toggles, want) }
+
+	book, err := api.BookByID(1)
+	if err != nil { t.Fatal(err) }
+	if book.IsRead() || book.IsArchived() { t.Errorf("read %v, archived %v", book.IsRead(), book.IsArchived()) }
+	if err = api.ToggleArchived(2); err == nil { t.Error("toggled a missing book") }
+}
@@ -0,0 +1,125 @@
+package calibre
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// selectors are the parts of the calibre-web templates the scraper depends on
+type selectors struct {
+	title string
+	authors string
+	tags string
+	publisher string
+	comments string
+	published string
+	rating string
+	read string
+	archived string
+	formats string
+	languages string
+	identifiers string
+}
+
+var defaultSelectors = &selectors{
+	title: "h2#title",
+	authors: ".author a",
+	tags: ".tags a",
+	publisher: ".publishers a",
+	comments: ".comments",
+	published: ".publishing-date p",
+	rating: ".rating .good",
+	read: "#have_read_cb",
+	archived: "#archived_cb",
+	formats: `a[href*="/download/"]`,
+	languages: ".languages span",
+	identifiers: ".identifiers a",
+}
+
+// selectorVersions are the changes of the templates, newest first. Each
+// entry applies to its version and later, up to the next newer entry.
+var selectorVersions = []struct {
+	since Version
+	sel *selectors
+}{
+	{Version{0, 6, 8}, defaultSelectors},
+	// Archiving books was added in 0.6.8
+	{Version{0, 6, 0}, defaultSelectors.with(func(s *selectors) { s.archived = "" })},
+	// Formats were only listed in the download button group
+	{Version{0, 0, 0}, defaultSelectors.with(func(s *selectors) {
+		s.archived = ""
+		s.formats = ".btn-group > :first-child a"
+	})},
+}
+
+// with returns a copy of sel changed by f
+func (sel *selectors) with(f func(s *selectors)) *selectors {
+	s := *sel
+	f(&s)
+	return &s
+}
+
+// Version is a calibre-web version like 0.6.19
+type Version [3]int
+
+func ParseVersion(s string) (Version, bool) {
+	var v Version
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(s, " -+"); i >= 0 { s = s[:i] }
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 { return v, false }
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil { return v, false }
+		v[i] = n
+	}
+	return v, true
+}
+
+func (v Version) String() string { return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2]) }
+
+// Less reports whether v is older than o
+func (v Version) Less(o Version) bool {
+	for i := range v {
+		if v[i] != o[i] { return v[i] < o[i] }
+	}
+	return false
+}
+
+func selectorsFor(v Version) *selectors {
+	for _, sv := range selectorVersions {
+		if !v.Less(sv.since) { return sv.sel }
+	}
+	return defaultSelectors
+}
+
+// selectors returns the selectors for the server version, ServerInfo may
+// change them while other goroutines parse pages
+func (api *API) selectors() *selectors {
+	api.selMu.Lock()
+	defer api.selMu.Unlock()
+	return api.sel
+}
+
+func (api *API) setSelectors(sel *selectors) {
+	api.selMu.Lock()
+	defer api.selMu.Unlock()
+	api.sel = sel
+}
+
+// parseFormatLink reads the format from a download link or from its text
+func parseFormatLink(s *goquery.Selection) (Format, bool) {
+	if href, ok := s.Attr("href"); ok {
+		parts := strings.Split(path.Clean(href), "/")
+		for i, p := range parts {
+			if p == "download" && i + 2 < len(parts) { return FormatFromExt(parts[i+2]) }
+		}
+	}
+	sp := strings.Fields(s.Text())
+	if len(sp) == 0 { return 0, false }
+	return FormatFromExt(sp[0])
+}
@@ -0,0 +1,95 @@
+package calibre
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in string
+		want Version
+		ok bool
+	}{
+		{"0.6.19", Version{0, 6, 19}, true},
+		{"v0.6.12", Version{0, 6, 12}, true},
+		{"0.6.20 Beta", Version{0, 6, 20}, true},
+		{"0.6.13-nightly+abc", Version{0, 6, 13}, true},
+		{"0.6", Version{0, 6, 0}, true},
+		{"nightly", Version{}, false},
+		{"0.6.x", Version{}, false},
+		{"1.2.3.4", Version{}, false},
+	}
+	for _, test := range tests {
+		got, ok := ParseVersion(test.in)
+		if ok != test.ok || ok && got != test.want { t.Errorf("ParseVersion(%q) = %v, %v", test.in, got, ok) }
+	}
+}
+
+func TestSelectorsFor(t *testing.T) {
+	tests := []struct {
+		v Version
+		archived bool
+		formats string
+	}{
+		{Version{0, 6, 19}, true, defaultSelectors.formats},
+		{Version{0, 6, 8}, true, defaultSelectors.formats},
+		{Version{0, 6, 7}, false, defaultSelectors.formats},
+		{Version{0, 6, 0}, false, defaultSelectors.formats},
+		{Version{0, 5, 9}, false, ".btn-group > :first-child a"},
+		{Version{}, false, ".btn-group > :first-child a"},
+	}
+	for _, test := range tests {
+		sel := selectorsFor(test.v)
+		if (sel.archived != "") != test.archived || sel.formats != test.formats { t.Errorf("%v: archived %q, formats %q", test.v, sel.archived, sel.formats) }
+		if sel.title != defaultSelectors.title { t.Errorf("%v: title %q", test.v, sel.title) }
+	}
+	if defaultSelectors.archived == "" { t.Error("deriving selectors changed defaultSelectors") }
+}
+
+const testBookPage = `<html><body><div class="single">
+<h2 id="title">The Colour of Magic</h2>
+<p class="author"><a href="/author/1">Terry Pratchett</a></p>
+<div class="tags"><a href="/category/2">Fantasy</a></div>
+<a href="/download/%d/epub/book.epub">EPUB (1.2 MB)</a>
+<div class="comments"><h3>Description</h3><p>The first Discworld novel.</p></div>
+</div></body></html>`
+
+// TestSelectorsConcurrent is meant for go test -race
+func TestSelectorsConcurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stats":
+			fmt.Fprintf(w, testStatsPage, 3, 1, 1, 0, `<tr><th>Calibre Web</th><td>0.6.7</td></tr>`)
+		case "/book/1", "/book/2", "/book/3":
+			fmt.Fprintf(w, testBookPage, 1)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+
+	var wg sync.WaitGroup
+	for id := uint64(1); id <= 3; id++ {
+		wg.Add(1)
+		go func(id uint64) {
+			defer wg.Done()
+			book, err := api.BookByID(id)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if book.Title != "The Colour of Magic" || !book.HasFormat(FormatEPUB) { t.Errorf("book %d: %+v", id, book) }
+		}(id)
+	}
+	info, err := api.ServerInfo()
+	wg.Wait()
+	if err != nil { t.Fatal(err) }
+	if info.Version != (Version{0, 6, 7}) { t.Errorf("version %v", info.Version) }
+	if api.selectors().archived != "" { t.Error("selectors were not switched to the server version") }
+}
@@ -0,0 +1,55 @@
+package calibre
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SendToEReader emails a format of a book to the eReader address of the
+// current user. If from is another format calibre-web first converts from
+// it, which it only does from MOBI and AZW3. The returned task is then the
+// conversion, which queues the email once it finished. Tasks can be polled
+// with TaskByID.
+func (api *API) SendToEReader(id uint64, format, from Format) (*Task, error) {
+	c, name := 0, taskEmail
+	switch {
+	case from == format:
+	case from == FormatMOBI:
+		c, name = 1, taskConvert
+	case from == FormatAZW3:
+		c, name = 2, taskConvert
+	default:
+		return nil, fmt.Errorf("book %d: calibre-web converts only MOBI and AZW3 for sending, not %s", id, from)
+	}
+	return api.newTask(id, name, func() error {
+		u := fmt.Sprintf("%s/send/%d/%s/%d", api.url, id, format.Ext(), c)
+		req, err := http.NewRequest(http.MethodPost, u, nil)
+		if err != nil { return err }
+		req.Header.Set("X-Requested-With", "XMLHttpRequest")
+		resp, err := api.c.Do(req)
+		if err != nil { return err }
+		// Older versions send on GET
+		if resp.StatusCode == http.StatusMethodNotAllowed {
+			resp.Body.Close()
+			resp, err = api.c.Get(u)
+			if err != nil { return err }
+		}
+		defer resp.Body.Close()
+
+		if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") { return checkFlashAlert(resp) }
+
+		messages := []struct {
+			Type string `json:"type"`
+			Message string `json:"message"`
+		}{}
+		err = json.NewDecoder(resp.Body).Decode(&messages)
+		if err != nil { return err }
+		for _, m := range messages {
+			if m.Type == "danger" { return errors.New(m.Message) }
+		}
+		return nil
+	})
+}
@@ -0,0 +1,62 @@
+package calibre
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSendToEReader(t *testing.T) {
+	tasks := []taskResponse{}
+	queue := func(name string, id int) {
+		tasks = append(tasks, taskResponse{
+			ID: json.RawMessage(fmt.Sprintf(`"%d"`, len(tasks))),
+			Message: fmt.Sprintf(`%s: <a href="/book/%d">Book</a>`, name, id),
+		})
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var id, convert int
+		var ext string
+		if r.URL.Path == "/ajax/emailstat" {
+			json.NewEncoder(w).Encode(tasks)
+			return
+		}
+		if _, err := fmt.Sscanf(strings.Replace(r.URL.Path, "/", " ", -1), " send %d %s %d", &id, &ext, &convert); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		switch {
+		case id == 1 && r.Method == http.MethodPost:
+			// Older versions only send on GET
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		case id == 1 && convert == 0:
+			queue("E-mail", id)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `[{"type": "success", "message": "Book successfully queued for sending"}]`)
+		case id == 1:
+			queue("Convert", id)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `[{"type": "success", "message": "Book successfully queued for converting"}]`)
+		case id == 2:
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `[{"type": "danger", "message": "Please configure your eReader email address"}]`)
+		case id == 3:
+			fmt.Fprint(w, `<html><body><div id="flash_danger">Oops! There was an error sending the book</div></body></html>`)
+		}
+	}))
+	defer server.Close()
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+
+	task, err := api.SendToEReader(1, FormatEPUB, FormatEPUB)
+	if err != nil || !strings.HasPrefix(task.Message, "E-mail") { t.Errorf("send: got %v, %v", task, err) }
+	task, err = api.SendToEReader(1, FormatEPUB, FormatMOBI)
+	if err != nil || !strings.HasPrefix(task.Message, "Convert") { t.Errorf("convert and send: got %v, %v", task, err) }
+	if _, err = api.SendToEReader(1, FormatEPUB, FormatPDF); err == nil { t.Error("sent with a conversion calibre-web doesn't do") }
+
+	if _, err = api.SendToEReader(2, FormatEPUB, FormatEPUB); err == nil || !strings.Contains(err.Error(), "configure your eReader") { t.Errorf("danger message: got error %v", err) }
+	if _, err = api.SendToEReader(3, FormatEPUB, FormatEPUB); err == nil || !strings.Contains(err.Error(), "error sending") { t.Errorf("flash message: got error %v", err) }
+}
@@ -0,0 +1,162 @@
+package calibre
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+type Capability uint8
+
+const (
+	CapKoboSync Capability = 1 << iota
+	CapOPDS
+	CapAdvancedSearch
+	// CapJSONEdit are the /ajax/editbooks endpoints of 0.6.12 and later
+	CapJSONEdit
+)
+
+var capabilityNames = []struct {
+	c Capability
+	name string
+}{
+	{CapKoboSync, "kobo"},
+	{CapOPDS, "opds"},
+	{CapAdvancedSearch, "advsearch"},
+	{CapJSONEdit, "jsonedit"},
+}
+
+// Capabilities is the set of optional features enabled on a server
+type Capabilities Capability
+
+func (cs Capabilities) Has(c Capability) bool { return Capability(cs) & c == c }
+
+func (cs Capabilities) String() string {
+	names := []string{}
+	for _, c := range capabilityNames {
+		if cs.Has(c.c) { names = append(names, c.name) }
+	}
+	return strings.Join(names, ",")
+}
+
+type ServerInfo struct {
+	Version Version
+	// RawVersion is the version as shown by the server, it may contain a commit or "nightly"
+	RawVersion string
+	// Libraries are the versions of the libraries calibre-web runs with
+	Libraries map[string]string
+
+	Books, Authors, Categories, Series int
+
+	// CalibreDir is the location of the Calibre database
+	CalibreDir string
+	// AdminSettings are the settings shown on /admin/view, which needs the admin role.
+	// Enabled features have the value "true".
+	AdminSettings map[string]string
+
+	Capabilities Capabilities
+}
+
+// ServerInfo reads the version and library statistics of the server and
+// detects its capabilities. The selectors used to parse pages are switched to
+// the ones matching the detected version.
+func (api *API) ServerInfo() (*ServerInfo, error) {
+	info, err := api.statsPage()
+	if err != nil { return nil, err }
+	if info.RawVersion == "" { return nil, fmt.Errorf("/stats: calibre-web version not found") }
+
+	// Only admins can see the settings, the rest works without them
+	if doc, err := api.document("/admin/view"); err == nil {
+		doc.Find(".row").Each(func(_ int, s *goquery.Selection) {
+			cols := s.ChildrenFiltered("div")
+			if cols.Length() != 2 { return }
+			key := strings.TrimSpace(cols.First().Text())
+			value := cols.Last()
+			if key == "" { return }
+			switch {
+			case value.Find(".glyphicon-ok").Length() > 0:
+				info.AdminSettings[key] = "true"
+			case value.Find(".glyphicon-remove").Length() > 0:
+				info.AdminSettings[key] = "false"
+			default:
+				info.AdminSettings[key] = strings.TrimSpace(value.Text())
+			}
+		})
+	}
+
+	var caps Capability
+	for key, value := range info.AdminSettings {
+		lower := strings.ToLower(key)
+		switch {
+		case strings.Contains(lower, "kobo") && value == "true":
+			caps |= CapKoboSync
+		case strings.Contains(lower, "calibre") && (strings.Contains(lower, "database") || strings.Contains(lower, "dir")):
+			info.CalibreDir = value
+		}
+	}
+	// OPDS uses basic auth and answers 401 to the session cookie
+	if status := api.status("/opds"); status == 200 || status == 401 { caps |= CapOPDS }
+	if api.status("/advsearch") == 200 { caps |= CapAdvancedSearch }
+	if !info.Version.Less(Version{0, 6, 12}) { caps |= CapJSONEdit }
+	info.Capabilities = Capabilities(caps)
+	return info, nil
+}
+
+// statsPage reads the library versions and counts of /stats. The selectors
+// are switched if the calibre-web version is found.
+func (api *API) statsPage() (*ServerInfo, error) {
+	info := &ServerInfo{Libraries: map[string]string{}, AdminSettings: map[string]string{}}
+
+	doc, err := api.document("/stats")
+	if err != nil { return nil, err }
+	// Rows are <th>library</th><td>version</td> below a header row in thead
+	doc.Find("#libs tbody tr").Each(func(_ int, s *goquery.Selection) {
+		cells := s.Find("th, td")
+		if cells.Length() < 2 { return }
+		info.Libraries[strings.TrimSpace(cells.First().Text())] = strings.TrimSpace(cells.Eq(1).Text())
+	})
+	// Rows are <th>count</th><td>label</td>, the labels are translated so
+	// the counts are read in their fixed order
+	counts := []*int{&info.Books, &info.Authors, &info.Categories, &info.Series}
+	doc.Find("#stats tr").Each(func(i int, s *goquery.Selection) {
+		if i >= len(counts) { return }
+		n, err := strconv.Atoi(strings.TrimSpace(s.Find("th, td").First().Text()))
+		if err == nil { *counts[i] = n }
+	})
+
+	for name, version := range info.Libraries {
+		if strings.EqualFold(name, "Calibre Web") || strings.EqualFold(name, "calibre-web") {
+			info.RawVersion = version
+			info.Version, _ = ParseVersion(version)
+		}
+	}
+	if info.RawVersion != "" { api.setSelectors(selectorsFor(info.Version)) }
+	return info, nil
+}
+
+// LibraryNames returns the names of Libraries sorted
+func (info *ServerInfo) LibraryNames() []string {
+	names := make([]string, 0, len(info.Libraries))
+	for name := range info.Libraries { names = append(names, name) }
+	sort.Strings(names)
+	return names
+}
+
+func (api *API) document(path string) (*goquery.Document, error) {
+	resp, err := api.c.Get(api.url + path)
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 { return nil, fmt.Errorf("%s: %s", path, resp.Status) }
+	return goquery.NewDocumentFromReader(resp.Body)
+}
+
+// status returns the status code of a page or 0 if the request failed
+func (api *API) status(path string) int {
+	resp, err := api.c.Get(api.url + path)
+	if err != nil { return 0 }
+	resp.Body.Close()
+	return resp.StatusCode
+}
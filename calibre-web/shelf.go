@@ -0,0 +1,177 @@
+package calibre
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var ErrShelfNotFound = errors.New("shelf not found")
+
+type Shelf struct {
+	id uint64
+	Name string
+	Public bool
+}
+
+func (shelf *Shelf) ID() uint64 { return shelf.id }
+
+func (shelf *Shelf) form() url.Values {
+	data := url.Values{"title": {shelf.Name}}
+	if shelf.Public { data.Set("is_public", "on") }
+	return data
+}
+
+// shelfID parses the id of links and redirects to /shelf/{id}
+func shelfID(u string) (uint64, bool) {
+	p, err := url.Parse(u)
+	if err != nil { return 0, false }
+	dir, base := path.Split(strings.TrimSuffix(p.Path, "/"))
+	if !strings.HasSuffix(dir, "/shelf/") { return 0, false }
+	id, err := strconv.ParseUint(base, 10, 0)
+	return id, err == nil
+}
+
+// ListShelves returns the shelves shown in the sidebar, which are
+// the shelves of the current user and all public shelves. The sidebar
+// shortens names and translates the public mark, so every shelf is read
+// from its own page.
+func (api *API) ListShelves() ([]*Shelf, error) {
+	resp, err := api.c.Get(api.url + "/")
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil { return nil, err }
+
+	ids := []uint64{}
+	seen := map[uint64]bool{}
+	doc.Find(`a[href*="/shelf/"]`).Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		id, ok := shelfID(href)
+		if !ok || seen[id] { return }
+		seen[id] = true
+		ids = append(ids, id)
+	})
+
+	shelves := make([]*Shelf, 0, len(ids))
+	for _, id := range ids {
+		shelf, err := api.shelfByID(id)
+		if err != nil { return nil, err }
+		shelves = append(shelves, shelf)
+	}
+	return shelves, nil
+}
+
+func (api *API) shelfPage(u string) (*goquery.Document, error) {
+	resp, err := api.c.Get(u)
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound { return nil, ErrShelfNotFound }
+	if resp.StatusCode != 200 { return nil, fmt.Errorf("%s: %s", u, resp.Status) }
+	return goquery.NewDocumentFromReader(resp.Body)
+}
+
+// shelfByID reads a shelf from its edit form. Shelves of other users can't
+// be edited, they are only visible because they are public and their name
+// is read from the heading of the shelf page.
+func (api *API) shelfByID(id uint64) (*Shelf, error) {
+	doc, err := api.shelfPage(fmt.Sprintf("%s/shelf/edit/%d", api.url, id))
+	if err != nil { return nil, err }
+	if title := doc.Find(`form input[name="title"]`); title.Length() > 0 {
+		_, public := doc.Find(`form input[name="is_public"]`).Attr("checked")
+		return &Shelf{id: id, Name: title.AttrOr("value", ""), Public: public}, nil
+	}
+
+	doc, err = api.shelfPage(fmt.Sprintf("%s/shelf/%d", api.url, id))
+	if err != nil { return nil, err }
+	// The heading quotes the name, like "Shelf: 'Name'"
+	heading := doc.Find("h2").First().Text()
+	start, end := strings.Index(heading, "'"), strings.LastIndex(heading, "'")
+	if start < 0 || end <= start { return nil, ErrShelfNotFound }
+	return &Shelf{id: id, Name: heading[start+1:end], Public: true}, nil
+}
+
+func (api *API) CreateShelf(name string, public bool) (*Shelf, error) {
+	shelf := &Shelf{Name: name, Public: public}
+	resp, err := api.c.PostForm(api.url + "/shelf/create", shelf.form())
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+
+	// calibre-web redirects to the new shelf
+	id, ok := shelfID(resp.Request.URL.String())
+	err = checkFlashAlert(resp)
+	if err != nil { return nil, err }
+	if !ok { return nil, errors.New("unable to parse shelf id") }
+	shelf.id = id
+	return shelf, nil
+}
+
+// UpdateShelf saves the name and visibility of shelf
+func (api *API) UpdateShelf(shelf *Shelf) error {
+	resp, err := api.c.PostForm(fmt.Sprintf("%s/shelf/edit/%d", api.url, shelf.id), shelf.form())
+	if err != nil { return err }
+	defer resp.Body.Close()
+	return checkFlashAlert(resp)
+}
+
+func (api *API) RenameShelf(id uint64, name string) error {
+	shelf, err := api.shelfByID(id)
+	if err != nil { return err }
+	shelf.Name = name
+	return api.UpdateShelf(shelf)
+}
+
+func (api *API) DeleteShelf(id uint64) error {
+	resp, err := api.c.PostForm(fmt.Sprintf("%s/shelf/delete/%d", api.url, id), nil)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	return checkFlashAlert(resp)
+}
+
+// ShelfBooks returns the books of a shelf in shelf order
+func (api *API) ShelfBooks(id uint64) ([]*ListBook, error) {
+	resp, err := api.c.Get(fmt.Sprintf("%s/shelf/%d", api.url, id))
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound { return nil, ErrShelfNotFound }
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil { return nil, err }
+	if flash := doc.Find("#flash_alert, #flash_danger"); len(flash.Nodes) > 0 {
+		return nil, errors.New(flash.Text())
+	}
+	return parseBookList(doc), nil
+}
+
+func (api *API) AddToShelf(shelf, book uint64) error {
+	resp, err := api.c.PostForm(fmt.Sprintf("%s/shelf/add/%d/%d", api.url, shelf, book), nil)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	return checkFlashAlert(resp)
+}
+
+func (api *API) RemoveFromShelf(shelf, book uint64) error {
+	resp, err := api.c.PostForm(fmt.Sprintf("%s/shelf/remove/%d/%d", api.url, shelf, book), nil)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	return checkFlashAlert(resp)
+}
+
+// ReorderShelf sets the order of the books in a shelf. books must contain every book of the shelf.
+func (api *API) ReorderShelf(shelf uint64, books []uint64) error {
+	data := url.Values{}
+	for i, id := range books {
+		data.Set(strconv.FormatUint(id, 10), strconv.Itoa(i + 1))
+	}
+	resp, err := api.c.PostForm(fmt.Sprintf("%s/shelf/order/%d", api.url, shelf), data)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	return checkFlashAlert(resp)
+}
@@ -0,0 +1,48 @@
+package calibre
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestListShelves(t *testing.T) {
+	long := "Discworld novels in publication order, City Watch included"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			// The sidebar shortens names and marks public shelves in the user's language
+			fmt.Fprint(w, `<ul id="nav_shelves">
+<li><a href="/shelf/1"><span class="glyphicon glyphicon-list shelf"></span>Discworld novels in publication order, ... (Öffentlich)</a></li>
+<li><a href="/shelf/2"><span class="glyphicon glyphicon-list shelf"></span>To read</a></li>
+<li><a href="/shelf/3"><span class="glyphicon glyphicon-list shelf"></span>Bob's picks (Öffentlich)</a></li>
+<li><a href="/shelf/1">Discworld</a></li>
+</ul>`)
+		case "/shelf/edit/1":
+			fmt.Fprintf(w, `<form method="post"><input type="text" name="title" value="%s"><input type="checkbox" name="is_public" checked></form>`, long)
+		case "/shelf/edit/2":
+			fmt.Fprint(w, `<form method="post"><input type="text" name="title" value="To read"><input type="checkbox" name="is_public"></form>`)
+		case "/shelf/edit/3":
+			// Not allowed, calibre-web redirects to the index
+			fmt.Fprint(w, `<div id="flash_danger">Sorry</div><form role="search"><input name="query"></form>`)
+		case "/shelf/3":
+			fmt.Fprint(w, `<h2>Bücherregal: 'Bob's picks'</h2>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+
+	shelves, err := api.ListShelves()
+	if err != nil { t.Fatal(err) }
+	want := []*Shelf{{1, long, true}, {2, "To read", false}, {3, "Bob's picks", true}}
+	if !reflect.DeepEqual(shelves, want) {
+		for _, s := range shelves { t.Errorf("got %+v", *s) }
+	}
+
+	if _, err = api.shelfByID(4); err != ErrShelfNotFound { t.Errorf("missing shelf: got error %v", err) }
+}
@@ -0,0 +1,107 @@
+package calibre
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// StatCount is a name with the number of books it appears in
+type StatCount struct {
+	Name string `json:"name"`
+	Count int `json:"count"`
+}
+
+type Stats struct {
+	Books int `json:"books"`
+	Authors int `json:"authors"`
+	Tags int `json:"tags"`
+	Series int `json:"series"`
+
+	// Formats is the number of books with each format
+	Formats map[Format]int `json:"formats"`
+	// Size is the total size of all formats, it is rounded by calibre-web
+	Size int64 `json:"size"`
+
+	NoCover []uint64 `json:"no_cover"`
+	NoDescription []uint64 `json:"no_description"`
+	NoIdentifiers []uint64 `json:"no_identifiers"`
+
+	TopAuthors []StatCount `json:"top_authors"`
+	TopTags []StatCount `json:"top_tags"`
+
+	// Errors holds the books that could not be checked with the reason, they
+	// are left out of the other fields
+	Errors map[uint64]string `json:"errors,omitempty"`
+}
+
+// topCounts returns the n names with the most books, n <= 0 returns all
+func topCounts(counts map[string]int, n int) []StatCount {
+	top := make([]StatCount, 0, len(counts))
+	for name, count := range counts { top = append(top, StatCount{name, count}) }
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count { return top[i].Count > top[j].Count }
+		return top[i].Name < top[j].Name
+	})
+	if n > 0 && len(top) > n { top = top[:n] }
+	return top
+}
+
+// Stats combines the counts of /stats with the details of every book, which
+// loads each book page and checks each cover with a HEAD request. top limits
+// TopAuthors and TopTags. Books that fail are recorded in Errors.
+func (api *API) Stats(ctx context.Context, top int) (*Stats, error) {
+	// Only the counts are needed, servers that hide their version still have them
+	info, err := api.statsPage()
+	if err != nil { return nil, err }
+	books, err := api.listBooks("root")
+	if err != nil { return nil, err }
+
+	stats := &Stats{
+		Books: info.Books,
+		Authors: info.Authors,
+		Tags: info.Categories,
+		Series: info.Series,
+		Formats: map[Format]int{},
+		NoCover: []uint64{},
+		NoDescription: []uint64{},
+		NoIdentifiers: []uint64{},
+		Errors: map[uint64]string{},
+	}
+	authors, tags := map[string]int{}, map[string]int{}
+
+	for i, b := range books {
+		if api.progress != nil { api.progress.Progress("stats", int64(i), int64(len(books))) }
+
+		book, err := api.bookByID(ctx, b.id)
+		if ctx.Err() != nil { return nil, ctx.Err() }
+		if err != nil {
+			stats.Errors[b.id] = err.Error()
+			continue
+		}
+
+		for _, format := range book.Formats() {
+			stats.Formats[format]++
+			size, _ := book.Size(format)
+			stats.Size += size
+		}
+		for _, author := range book.Authors { authors[author]++ }
+		for _, tag := range book.Categories { tags[tag]++ }
+
+		if book.Description == "" { stats.NoDescription = append(stats.NoDescription, book.id) }
+		if len(book.Identifiers) == 0 { stats.NoIdentifiers = append(stats.NoIdentifiers, book.id) }
+
+		hasCover, err := api.HasCover(ctx, book.id)
+		if ctx.Err() != nil { return nil, ctx.Err() }
+		if err != nil {
+			stats.Errors[b.id] = fmt.Sprintf("cover: %s", err)
+		} else if !hasCover {
+			stats.NoCover = append(stats.NoCover, book.id)
+		}
+	}
+	if api.progress != nil { api.progress.Done("stats") }
+
+	stats.TopAuthors = topCounts(authors, top)
+	stats.TopTags = topCounts(tags, top)
+	return stats, nil
+}
@@ -0,0 +1,113 @@
+package calibre
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testStatsPage is the stats.html of calibre-web with the counts and the
+// rows of the library versions
+const testStatsPage = `<!DOCTYPE html>
+<html><head><title>Calibre-Web | Statistics</title></head><body>
+<div class="discover">
+<h3>Library Statistics</h3>
+<table id="stats" class="table">
+  <tbody>
+  <tr>
+    <th>%d</th>
+    <td>Books in this Library</td>
+  </tr>
+  <tr>
+    <th>%d</th>
+    <td>Authors in this Library</td>
+  </tr>
+  <tr>
+    <th>%d</th>
+    <td>Categories in this Library</td>
+  </tr>
+  <tr>
+    <th>%d</th>
+    <td>Series in this Library</td>
+  </tr>
+  </tbody>
+</table>
+<h3>Linked Libraries</h3>
+<table id="libs" class="table">
+  <thead>
+  <tr>
+    <th>Program Library</th>
+    <th>Installed Version</th>
+  </tr>
+  </thead>
+  <tbody>
+  %s
+  </tbody>
+</table>
+</div></body></html>`
+
+func TestStatsPageVersions(t *testing.T) {
+	libs := `<tr>
+    <th>Calibre Web</th>
+    <td>0.6.19 Beta</td>
+  </tr>
+  <tr>
+    <th>Python</th>
+    <td>3.11.2</td>
+  </tr>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, testStatsPage, 1, 1, 0, 0, libs)
+	}))
+	defer server.Close()
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+
+	info, err := api.statsPage()
+	if err != nil { t.Fatal(err) }
+	if !reflect.DeepEqual(info.Libraries, map[string]string{"Calibre Web": "0.6.19 Beta", "Python": "3.11.2"}) { t.Errorf("libraries %v", info.Libraries) }
+	if info.Version != (Version{0, 6, 19}) { t.Errorf("version %v from %q", info.Version, info.RawVersion) }
+}
+
+func TestStatsWithoutVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stats":
+			// Servers can hide the library versions, the labels are translated
+			page := strings.Replace(fmt.Sprintf(testStatsPage, 2, 1, 3, 4, ""), "Books in this Library", "Bücher in dieser Bibliothek", 1)
+			fmt.Fprint(w, page)
+		case "/root/old/1/1":
+			fmt.Fprint(w, `<div class="book"><div class="meta"><a href="/book/1"><p class="title">The Colour of Magic</p></a></div></div>
+<div class="book"><div class="meta"><a href="/book/2"><p class="title">Broken</p></a></div></div>`)
+		case "/book/1":
+			fmt.Fprintf(w, testBookPage, 1)
+		case "/book/2":
+			fmt.Fprint(w, `<html><body><h1>Broken</h1></body></html>`)
+		case "/static/generic_cover.jpg", "/cover/1":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte("generic"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+
+	stats, err := api.Stats(context.Background(), 5)
+	if err != nil { t.Fatal(err) }
+	if stats.Books != 2 || stats.Authors != 1 || stats.Tags != 3 || stats.Series != 4 { t.Errorf("counts %d books, %d authors, %d tags, %d series", stats.Books, stats.Authors, stats.Tags, stats.Series) }
+	if !reflect.DeepEqual(stats.NoCover, []uint64{1}) { t.Errorf("no cover %v", stats.NoCover) }
+	if !reflect.DeepEqual(stats.TopAuthors, []StatCount{{"Terry Pratchett", 1}}) { t.Errorf("top authors %v", stats.TopAuthors) }
+	if stats.Formats[FormatEPUB] != 1 { t.Errorf("formats %v", stats.Formats) }
+	if len(stats.Errors) != 1 || stats.Errors[2] == "" { t.Errorf("errors %v", stats.Errors) }
+
+	if _, err := api.ServerInfo(); err == nil { t.Error("ServerInfo without version succeeded") }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = api.Stats(ctx, 5); err != context.Canceled { t.Errorf("cancelled stats: got error %v", err) }
+}
@@ -0,0 +1,180 @@
+package calibre
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TaskState is the stat field of calibre-web tasks
+type TaskState int
+
+const (
+	TaskWaiting TaskState = iota
+	TaskFailed
+	TaskStarted
+	TaskFinished
+	TaskEnded
+	TaskCancelled
+)
+
+func (s TaskState) String() string {
+	switch s {
+	case TaskWaiting:
+		return "waiting"
+	case TaskFailed:
+		return "failed"
+	case TaskStarted:
+		return "started"
+	case TaskFinished:
+		return "finished"
+	case TaskEnded:
+		return "ended"
+	case TaskCancelled:
+		return "cancelled"
+	default:
+		return fmt.Sprintf("state %d", int(s))
+	}
+}
+
+// Task is a background job like sending or converting a book
+type Task struct {
+	ID string
+	User string
+	// Message describes the task, like "E-mail: Title"
+	Message string
+	Progress string
+	Runtime string
+	Started string
+	// Status is the translated state shown to the user
+	Status string
+	State TaskState
+}
+
+// Done reports whether the task stopped running
+func (t *Task) Done() bool { return t.State != TaskWaiting && t.State != TaskStarted }
+
+// Succeeded reports whether the task finished without error. Ended tasks
+// were aborted and don't count.
+func (t *Task) Succeeded() bool { return t.State == TaskFinished }
+
+// Task names at the start of Message
+const (
+	taskEmail = "E-mail"
+	taskConvert = "Convert"
+)
+
+// bookLink matches the links to book pages in task messages
+var bookLink = regexp.MustCompile(`/book/(\d+)\b`)
+
+// forBook reports whether the message links the book, ok is false for
+// messages without a book link, older versions only name the title
+func (t *Task) forBook(id uint64) (match, ok bool) {
+	m := bookLink.FindStringSubmatch(t.Message)
+	if m == nil { return false, false }
+	return m[1] == strconv.FormatUint(id, 10), true
+}
+
+type taskResponse struct {
+	ID json.RawMessage `json:"id"`
+	User string `json:"user"`
+	Message string `json:"taskMessage"`
+	Progress string `json:"progress"`
+	Runtime string `json:"runtime"`
+	Started string `json:"starttime"`
+	Status string `json:"status"`
+	State TaskState `json:"stat"`
+}
+
+// ListTasks returns the tasks of the current user, or of all users for admins.
+// The /tasks page is only a table that loads this data from /ajax/emailstat.
+func (api *API) ListTasks() ([]*Task, error) {
+	resp, err := api.c.Get(api.url + "/ajax/emailstat")
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 { return nil, fmt.Errorf("tasks: %s", resp.Status) }
+
+	list := []taskResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	if err != nil { return nil, err }
+
+	tasks := make([]*Task, 0, len(list))
+	for _, t := range list {
+		tasks = append(tasks, &Task{
+			// Older versions number the tasks, newer ones use uuids
+			ID: strings.Trim(string(t.ID), `"`),
+			User: t.User,
+			Message: t.Message,
+			Progress: t.Progress,
+			Runtime: t.Runtime,
+			Started: t.Started,
+			Status: t.Status,
+			State: t.State,
+		})
+	}
+	return tasks, nil
+}
+
+// TaskByID finds a task in ListTasks
+func (api *API) TaskByID(id string) (*Task, error) {
+	tasks, err := api.ListTasks()
+	if err != nil { return nil, err }
+	for _, task := range tasks {
+		if task.ID == id { return task, nil }
+	}
+	return nil, fmt.Errorf("task %s not found", id)
+}
+
+// newTask runs queue and returns the task it added for book id. Admins see
+// the tasks of all users, so new tasks of other users, other books or
+// another kind than name are skipped.
+func (api *API) newTask(id uint64, name string, queue func() error) (*Task, error) {
+	before, err := api.ListTasks()
+	if err != nil { return nil, err }
+	known := map[string]bool{}
+	for _, task := range before { known[task.ID] = true }
+
+	err = queue()
+	if err != nil { return nil, err }
+
+	after, err := api.ListTasks()
+	if err != nil { return nil, err }
+	unlinked := []*Task{}
+	for _, task := range after {
+		if known[task.ID] || (api.username != "" && task.User != "" && task.User != api.username) { continue }
+		// The name is translated, only skip tasks that are known to be another kind
+		if n := strings.SplitN(task.Message, ":", 2)[0]; n != name && (n == taskEmail || n == taskConvert) { continue }
+		match, ok := task.forBook(id)
+		if match { return task, nil }
+		if !ok { unlinked = append(unlinked, task) }
+	}
+	if len(unlinked) == 1 { return unlinked[0], nil }
+	if len(unlinked) > 1 { return nil, fmt.Errorf("book %d: %d new tasks, can't tell which was queued", id, len(unlinked)) }
+	return nil, fmt.Errorf("book %d: queued task not found", id)
+}
+
+// taskPollInterval is the time between task status requests of WaitTask
+const taskPollInterval = 2 * time.Second
+
+// WaitTask polls a task until it is done. A task that failed or was
+// cancelled is returned with an error.
+func (api *API) WaitTask(ctx context.Context, task *Task) (*Task, error) {
+	ticker := time.NewTicker(taskPollInterval)
+	defer ticker.Stop()
+	for !task.Done() {
+		select {
+		case <-ctx.Done():
+			return task, ctx.Err()
+		case <-ticker.C:
+		}
+		t, err := api.TaskByID(task.ID)
+		if err != nil { return task, err }
+		task = t
+	}
+	if !task.Succeeded() { return task, fmt.Errorf("task %s %s: %s", task.ID, task.State, task.Message) }
+	return task, nil
+}
@@ -0,0 +1,77 @@
+package calibre
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// taskServer serves the task list, queueing a conversion adds the tasks in
+// added besides the old ones
+func taskServer(t *testing.T, added []taskResponse) *API {
+	tasks := []taskResponse{{ID: json.RawMessage(`"old"`), User: "admin", Message: `Convert: <a href="/book/1">Mort</a>`, State: TaskStarted}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/login":
+		case r.URL.Path == "/ajax/emailstat":
+			json.NewEncoder(w).Encode(tasks)
+		case strings.HasPrefix(r.URL.Path, "/book/convert/"):
+			tasks = append(tasks, added...)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+	if err = api.Login("admin", "secret"); err != nil { t.Fatal(err) }
+	return api
+}
+
+func TestNewTaskMatches(t *testing.T) {
+	task := func(id, user, message string) taskResponse {
+		return taskResponse{ID: json.RawMessage(fmt.Sprintf("%q", id)), User: user, Message: message}
+	}
+	tests := []struct {
+		name string
+		added []taskResponse
+		want string
+	}{
+		{"other user first", []taskResponse{
+			task("a", "bob", `Convert: <a href="/book/1">Mort</a>`),
+			task("b", "admin", `Convert: <a href="/book/1">Mort</a>`),
+		}, "b"},
+		{"other book first", []taskResponse{
+			task("a", "admin", `Convert: <a href="/book/11">Sourcery</a>`),
+			task("b", "admin", `Convert: <a href="/book/1">Mort</a>`),
+		}, "b"},
+		{"other kind first", []taskResponse{
+			task("a", "admin", `E-mail: <a href="/book/1">Mort</a>`),
+			task("b", "admin", `Convert: <a href="/book/1">Mort</a>`),
+		}, "b"},
+		{"translated name", []taskResponse{task("a", "admin", `Konvertieren: <a href="/book/1">Mort</a>`)}, "a"},
+		{"message without link", []taskResponse{task("a", "admin", "Convert: Mort")}, "a"},
+		{"ambiguous without links", []taskResponse{task("a", "admin", "Convert: Mort"), task("b", "admin", "Convert: Eric")}, ""},
+		{"only others", []taskResponse{task("a", "bob", `Convert: <a href="/book/1">Mort</a>`)}, ""},
+	}
+	for _, test := range tests {
+		got, err := taskServer(t, test.added).ConvertFormat(1, FormatEPUB, FormatMOBI)
+		switch {
+		case test.want == "" && err == nil:
+			t.Errorf("%s: got task %s, want error", test.name, got.ID)
+		case test.want != "" && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.want != "" && got.ID != test.want:
+			t.Errorf("%s: got task %s, want %s", test.name, got.ID, test.want)
+		}
+	}
+}
+
+func TestTaskSucceeded(t *testing.T) {
+	for state, want := range map[TaskState]bool{TaskFinished: true, TaskEnded: false, TaskCancelled: false, TaskFailed: false} {
+		if got := (&Task{State: state}).Succeeded(); got != want { t.Errorf("%s: Succeeded() = %v", state, got) }
+	}
+}
@@ -0,0 +1,94 @@
+package calibre
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yrhki/gocalibre/calibre-web/convert"
+)
+
+// UploadSpec describes a book and everything that should be uploaded with it.
+// All paths may also be URLs.
+type UploadSpec struct {
+	Primary string
+	ExtraFormats []string
+	Cover string
+	// ConvertTo formats are created from Primary, which has to be a local
+	// file, with Converter and uploaded like ExtraFormats
+	ConvertTo []Format
+	Converter convert.Converter
+	// Metadata replaces the metadata detected by calibre-web when set, empty
+	// fields keep the detected value
+	Metadata *Book
+}
+
+// UploadBook uploads the primary file, extra formats, cover and metadata
+// of spec. If any step fails the created book is deleted again. A complete
+// book is kept if only loading it afterwards fails, it is returned as
+// uploaded with the error.
+func (api *API) UploadBook(ctx context.Context, spec UploadSpec) (book *Book, err error) {
+	// The rollback is armed with the ID, loading the new book can still fail
+	var id uint64
+	defer func() {
+		if err == nil || id == 0 { return }
+		// ctx may already be cancelled, the rollback has to run regardless
+		if rerr := api.DeleteBook(id); rerr != nil {
+			err = fmt.Errorf("%w (rollback of book %d failed: %v)", err, id, rerr)
+		}
+		book = nil
+	}()
+
+	book, err = api.upload(ctx, spec.Primary, func(created uint64) error {
+		id = created
+		return nil
+	})
+	if err != nil { return nil, err }
+
+	for _, uri := range spec.ExtraFormats {
+		err = api.bookUploadFormat(ctx, book, uri)
+		if err != nil { return book, fmt.Errorf("uploading format %s: %w", uri, err) }
+	}
+
+	if len(spec.ConvertTo) > 0 {
+		err = api.UploadConverted(ctx, book, spec.Converter, spec.Primary, spec.ConvertTo)
+		if err != nil { return book, fmt.Errorf("uploading converted formats: %w", err) }
+	}
+
+	if spec.Cover != "" {
+		err = api.updateBookCover(ctx, book.id, spec.Cover)
+		if err != nil { return book, fmt.Errorf("uploading cover: %w", err) }
+	}
+
+	if spec.Metadata != nil {
+		m := mergeMetadata(book, spec.Metadata)
+		err = api.updateBookMetadata(ctx, m)
+		if err != nil { return book, fmt.Errorf("updating metadata: %w", err) }
+	}
+
+	// Everything is on the server, the rollback is disarmed
+	id = 0
+	result, err := api.bookByID(ctx, book.id)
+	if err != nil { return book, fmt.Errorf("book %d uploaded, loading it: %w", book.id, err) }
+	result.checksums = book.checksums
+	return result, nil
+}
+
+// mergeMetadata returns a copy of book with the fields set in m
+func mergeMetadata(book, m *Book) *Book {
+	b := *book
+	if m.Title != "" { b.Title = m.Title }
+	if m.Series != "" { b.Series, b.SeriesIndex = m.Series, m.SeriesIndex }
+	if m.Rating != 0 { b.Rating = m.Rating }
+	if m.Published != nil { b.Published = m.Published }
+	if m.Description != "" { b.Description = m.Description }
+	if len(m.Authors) > 0 { b.Authors = m.Authors }
+	if len(m.Categories) > 0 { b.Categories = m.Categories }
+	if m.Publisher != "" { b.Publisher = m.Publisher }
+	if len(m.Languages) > 0 { b.Languages = m.Languages }
+	if len(m.Identifiers) > 0 {
+		b.Identifiers = BookIdentifiers{}
+		for k, v := range book.Identifiers { b.Identifiers[k] = v }
+		for k, v := range m.Identifiers { b.Identifiers[k] = v }
+	}
+	return &b
+}
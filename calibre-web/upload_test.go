@@ -0,0 +1,169 @@
+package calibre
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yrhki/gocalibre/calibre-web/convert"
+)
+
+// writeEPUB creates a minimal EPUB that passes the upload checks
+func writeEPUB(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "mort.epub")
+	f, err := os.Create(path)
+	if err != nil { t.Fatal(err) }
+	defer f.Close()
+	z := zip.NewWriter(f)
+	w, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil { t.Fatal(err) }
+	w.Write([]byte("application/epub+zip"))
+	if err = z.Close(); err != nil { t.Fatal(err) }
+	return path
+}
+
+func TestUploadBookRollsBackUnloadableBook(t *testing.T) {
+	var deleted bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/upload":
+			w.Write([]byte(`{"location": "/book/7"}`))
+		case "/book/7":
+			// A template the selectors don't match
+			w.Write([]byte(`<html><body><h1>Mort</h1></body></html>`))
+		case "/delete/7":
+			deleted = true
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+
+	book, err := api.UploadBook(context.Background(), UploadSpec{Primary: writeEPUB(t)})
+	if err == nil || book != nil { t.Fatalf("got book %v, error %v", book, err) }
+	if !deleted { t.Error("book that could not be loaded was not deleted") }
+
+	var notified uint64
+	_, err = api.UploadNotify(writeEPUB(t), func(id uint64) error {
+		notified = id
+		return nil
+	})
+	if err == nil || notified != 7 { t.Errorf("notified %d, error %v", notified, err) }
+}
+
+func TestMergeMetadata(t *testing.T) {
+	published := time.Date(1987, 11, 12, 0, 0, 0, 0, time.UTC)
+	book := &Book{id: 7, Title: "mort", Authors: []string{"Unknown"}, Publisher: "Gollancz", Identifiers: BookIdentifiers{"isbn": "0575041714"}}
+	m := &Book{Title: "Mort", Authors: []string{"Terry Pratchett"}, Published: &published, Identifiers: BookIdentifiers{"goodreads": "386372"}}
+
+	got := mergeMetadata(book, m)
+	if got.ID() != 7 || got.Title != "Mort" || got.Authors[0] != "Terry Pratchett" || got.Publisher != "Gollancz" || got.Published != &published {
+		t.Errorf("got %+v", got)
+	}
+	if len(got.Identifiers) != 2 || len(book.Identifiers) != 1 { t.Errorf("identifiers %v, book identifiers %v", got.Identifiers, book.Identifiers) }
+}
+
+// uploadServer accepts uploads as book 7 and records the uploaded formats
+func uploadServer(t *testing.T) (*API, *[]string, *bool) {
+	var formats []string
+	var deleted bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/upload":
+			w.Write([]byte(`{"location": "/book/7"}`))
+		case "/book/7":
+			fmt.Fprintf(w, testBookPage, 7)
+		case "/admin/book/7":
+			_, header, err := r.FormFile("btn-upload-format")
+			if err == nil { formats = append(formats, header.Filename) }
+		case "/delete/7":
+			deleted = true
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+	return api, &formats, &deleted
+}
+
+func TestUploadConverted(t *testing.T) {
+	api, formats, deleted := uploadServer(t)
+	src := writeEPUB(t)
+	book, err := api.Upload(src)
+	if err != nil { t.Fatal(err) }
+
+	stub := &convert.Stub{Data: []byte("Death takes an apprentice.")}
+	err = api.UploadConverted(context.Background(), book, stub, src, []Format{FormatEPUB, FormatTXT})
+	if err != nil { t.Fatal(err) }
+	if len(stub.Calls) != 1 || stub.Calls[0].To != FormatTXT { t.Errorf("converter calls %v", stub.Calls) }
+	if len(*formats) != 1 || (*formats)[0] != "mort.txt" { t.Errorf("uploaded formats %v", *formats) }
+	if _, ok := book.Checksum(FormatTXT); !ok { t.Error("no checksum of the converted format") }
+
+	stub.Err = errors.New("conversion failed")
+	_, err = api.UploadBook(context.Background(), UploadSpec{Primary: src, ConvertTo: []Format{FormatTXT}, Converter: stub})
+	if !errors.Is(err, stub.Err) { t.Errorf("got error %v", err) }
+	if !*deleted { t.Error("book was not rolled back after the conversion failed") }
+}
+
+func TestUploadBookKeepsCompleteBook(t *testing.T) {
+	var loads int
+	var deleted bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/upload":
+			w.Write([]byte(`{"location": "/book/7"}`))
+		case "/book/7":
+			// Only the reload after the metadata was saved fails
+			loads++
+			if loads == 1 {
+				fmt.Fprintf(w, testBookPage, 7)
+			} else {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			}
+		case "/admin/book/7":
+		case "/delete/7":
+			deleted = true
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+
+	book, err := api.UploadBook(context.Background(), UploadSpec{Primary: writeEPUB(t), Metadata: &Book{Title: "Mort"}})
+	if err == nil || book == nil || book.ID() != 7 { t.Errorf("got book %v, error %v", book, err) }
+	if deleted { t.Error("complete book was deleted because reloading it failed") }
+}
+
+func TestLoadURIFile(t *testing.T) {
+	path := writeEPUB(t)
+	api, err := NewAPI("http://localhost")
+	if err != nil { t.Fatal(err) }
+
+	tests := []struct {
+		uri string
+		ok bool
+	}{
+		{path, true},
+		{"file://" + path, true},
+		{"file://localhost" + path, true},
+		{"file://example.com" + path, false},
+	}
+	for _, test := range tests {
+		c, err := api.loadURI(context.Background(), test.uri)
+		if (err == nil) != test.ok { t.Errorf("%s: error %v", test.uri, err) }
+		if err == nil { c.Close() }
+	}
+}
@@ -0,0 +1,120 @@
+package uploadcontent
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/yrhki/gocalibre/calibre-web/format"
+)
+
+var ErrNoCover = errors.New("no cover found")
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type opfPackage struct {
+	Metas []struct {
+		Name string `xml:"name,attr"`
+		Content string `xml:"content,attr"`
+	} `xml:"metadata>meta"`
+	Items []struct {
+		ID string `xml:"id,attr"`
+		Href string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+}
+
+// ExtractCover returns the cover image of an EPUB or CBZ file and its name in the archive
+func ExtractCover(r io.ReaderAt, size int64) ([]byte, string, error) {
+	f, ok := Sniff(r, size)
+	if !ok || f != format.EPUB && f != format.CBZ { return nil, "", ErrUnknownFormat }
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil { return nil, "", err }
+
+	var name string
+	if f == format.EPUB {
+		name, err = epubCover(zr)
+		if err != nil { return nil, "", err }
+	} else {
+		name = comicCover(zr)
+	}
+	if name == "" { return nil, "", ErrNoCover }
+
+	b, err := readZipFile(zr, name)
+	return b, name, err
+}
+
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name { continue }
+		rc, err := f.Open()
+		if err != nil { return nil, err }
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+	return nil, ErrNoCover
+}
+
+func readZipXML(zr *zip.Reader, name string, v interface{}) error {
+	b, err := readZipFile(zr, name)
+	if err != nil { return err }
+	return xml.Unmarshal(b, v)
+}
+
+// epubCover finds the cover in the OPF manifest, from the EPUB 3 cover-image
+// property, the EPUB 2 cover meta or an image item with cover in its id
+func epubCover(zr *zip.Reader) (string, error) {
+	var container epubContainer
+	err := readZipXML(zr, "META-INF/container.xml", &container)
+	if err != nil { return "", err }
+	if len(container.Rootfiles) == 0 { return "", ErrNoCover }
+
+	opfPath := container.Rootfiles[0].FullPath
+	var opf opfPackage
+	err = readZipXML(zr, opfPath, &opf)
+	if err != nil { return "", err }
+
+	resolve := func(href string) string { return path.Join(path.Dir(opfPath), href) }
+
+	for _, item := range opf.Items {
+		for _, p := range strings.Fields(item.Properties) {
+			if p == "cover-image" { return resolve(item.Href), nil }
+		}
+	}
+
+	for _, meta := range opf.Metas {
+		if meta.Name != "cover" { continue }
+		for _, item := range opf.Items {
+			if item.ID == meta.Content { return resolve(item.Href), nil }
+		}
+	}
+
+	for _, item := range opf.Items {
+		if strings.HasPrefix(item.MediaType, "image/") && strings.Contains(strings.ToLower(item.ID), "cover") {
+			return resolve(item.Href), nil
+		}
+	}
+	return "", nil
+}
+
+// comicCover is the first image of the archive by name
+func comicCover(zr *zip.Reader) string {
+	var images []string
+	for _, f := range zr.File {
+		if imageExts[strings.ToLower(path.Ext(f.Name))] { images = append(images, f.Name) }
+	}
+	if len(images) == 0 { return "" }
+	sort.Strings(images)
+	return images[0]
+}
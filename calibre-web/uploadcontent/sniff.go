@@ -0,0 +1,194 @@
+package uploadcontent
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/yrhki/gocalibre/calibre-web/format"
+)
+
+// sniffLen is the number of leading bytes SniffHeader needs for reliable results
+const sniffLen = 4096
+
+var ErrUnknownFormat = errors.New("unknown book format")
+
+// FormatMismatchError is returned when the extension of a file does not match its contents
+type FormatMismatchError struct {
+	Filename string
+	Detected format.Format
+}
+
+func (e *FormatMismatchError) Error() string {
+	return fmt.Sprintf("%s: file contains %s", e.Filename, e.Detected)
+}
+
+var zipMimetypes = map[string]format.Format{
+	"application/epub+zip": format.EPUB,
+	"application/vnd.oasis.opendocument.text": format.ODT,
+}
+
+var imageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
+
+// SniffHeader detects the format from the leading bytes of a file.
+// ZIP based formats can only be told apart if they start with a mimetype entry,
+// use Sniff when the whole file is available.
+func SniffHeader(b []byte) (format.Format, bool) {
+	switch {
+	case bytes.HasPrefix(b, []byte("%PDF-")):
+		return format.PDF, true
+	case bytes.HasPrefix(b, []byte("Rar!\x1a\x07")):
+		return format.CBR, true
+	case bytes.HasPrefix(b, []byte("7z\xbc\xaf\x27\x1c")):
+		return format.CB7, true
+	case bytes.HasPrefix(b, []byte("{\\rtf")):
+		return format.RTF, true
+	case bytes.HasPrefix(b, []byte("ITOLITLS")):
+		return format.LIT, true
+	case bytes.HasPrefix(b, []byte("L\x00R\x00F\x00")):
+		return format.LRF, true
+	case bytes.HasPrefix(b, []byte("PK\x03\x04")):
+		return sniffZipHeader(b)
+	}
+	if f, ok := sniffPalmDB(bytes.NewReader(b)); ok { return f, true }
+	if isFictionBook(b) { return format.FB2, true }
+	return 0, false
+}
+
+// Sniff detects the format of a complete file
+func Sniff(r io.ReaderAt, size int64) (format.Format, bool) {
+	b := make([]byte, sniffLen)
+	n, err := r.ReadAt(b, 0)
+	if err != nil && err != io.EOF { return 0, false }
+	b = b[:n]
+
+	if !bytes.HasPrefix(b, []byte("PK\x03\x04")) {
+		if f, ok := sniffPalmDB(r); ok { return f, true }
+		return SniffHeader(b)
+	}
+	if f, ok := sniffZipHeader(b); ok { return f, true }
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil { return 0, false }
+	return sniffZip(zr)
+}
+
+// sniffZipHeader reads the first local file header, which is the mimetype for EPUB and ODT
+func sniffZipHeader(b []byte) (format.Format, bool) {
+	if len(b) < 30 { return 0, false }
+	method := binary.LittleEndian.Uint16(b[8:])
+	csize := int(binary.LittleEndian.Uint32(b[18:]))
+	nameLen := int(binary.LittleEndian.Uint16(b[26:]))
+	extraLen := int(binary.LittleEndian.Uint16(b[28:]))
+	start := 30 + nameLen + extraLen
+	if method != zip.Store || len(b) < start + csize || string(b[30:30+nameLen]) != "mimetype" { return 0, false }
+	if csize == 0 {
+		// Sizes are in a data descriptor after the content
+		for mimetype, f := range zipMimetypes {
+			if bytes.HasPrefix(b[start:], []byte(mimetype)) { return f, true }
+		}
+		return 0, false
+	}
+	f, ok := zipMimetypes[strings.TrimSpace(string(b[start:start+csize]))]
+	return f, ok
+}
+
+func sniffZip(zr *zip.Reader) (format.Format, bool) {
+	names := map[string]bool{}
+	images := 0
+	for _, f := range zr.File {
+		names[f.Name] = true
+		if imageExts[strings.ToLower(path.Ext(f.Name))] { images++ }
+	}
+
+	for _, f := range zr.File {
+		if f.Name != "mimetype" { continue }
+		rc, err := f.Open()
+		if err != nil { return 0, false }
+		b, err := ioutil.ReadAll(io.LimitReader(rc, 128))
+		rc.Close()
+		if err != nil { return 0, false }
+		if f, ok := zipMimetypes[strings.TrimSpace(string(b))]; ok { return f, true }
+	}
+
+	switch {
+	case names["[Content_Types].xml"] && names["word/document.xml"]:
+		return format.DOCX, true
+	case names["META-INF/container.xml"]:
+		return format.EPUB, true
+	case names["index.html"] && names["metadata.opf"]:
+		return format.HTMLZ, true
+	case images > 0 && images == len(zr.File) - countDirs(zr):
+		return format.CBZ, true
+	}
+	return 0, false
+}
+
+func countDirs(zr *zip.Reader) int {
+	n := 0
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") { n++ }
+	}
+	return n
+}
+
+// sniffPalmDB detects MOBI and AZW3 from the PalmDB header and the MOBI header
+// of the first record. PalmDOC (TEXtREAd) books are not detected, they have no
+// format of their own.
+func sniffPalmDB(r io.ReaderAt) (format.Format, bool) {
+	header := make([]byte, 86)
+	if _, err := r.ReadAt(header, 0); err != nil { return 0, false }
+	if string(header[60:68]) != "BOOKMOBI" { return 0, false }
+
+	record0 := int64(binary.BigEndian.Uint32(header[78:]))
+	mobi := make([]byte, 40)
+	if _, err := r.ReadAt(mobi, record0); err != nil { return format.MOBI, true }
+	if string(mobi[16:20]) != "MOBI" { return format.MOBI, true }
+
+	// KF8 only files have file version 8, joint MOBI/KF8 files are still reported as MOBI
+	if binary.BigEndian.Uint32(mobi[36:]) == 8 { return format.AZW3, true }
+	return format.MOBI, true
+}
+
+func isFictionBook(b []byte) bool {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	d.Strict = false
+	for {
+		t, err := d.Token()
+		if err != nil { return false }
+		switch t := t.(type) {
+		case xml.StartElement:
+			return t.Name.Local == "FictionBook"
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 { return false }
+		}
+	}
+}
+
+// compatible reports whether a file detected as detected may be uploaded with the extension of ext
+func compatible(ext, detected format.Format) bool {
+	if ext == detected { return true }
+	// Kindle formats share the PalmDB container and plain text may look like anything
+	kindle := func(f format.Format) bool { return f == format.MOBI || f == format.AZW3 }
+	return kindle(ext) && kindle(detected) || ext == format.TXT
+}
+
+// Check returns an error if the extension of c is a known format but the
+// content is detected as a different one. Extensions calibre-web accepts
+// that are not in format.All, like azw, kepub or mp3, are not checked.
+func Check(c Content) error {
+	ext, ok := format.FromExt(path.Ext(c.Filename()))
+	if !ok { return nil }
+	detected, sniffed := c.Format()
+	if sniffed && !compatible(ext, detected) {
+		return &FormatMismatchError{Filename: c.Filename(), Detected: detected}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package uploadcontent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/yrhki/gocalibre/calibre-web/format"
+)
+
+// palmDB builds a PalmDB file of kind with a MOBI header of version in the first record
+func palmDB(kind string, version uint32) []byte {
+	b := make([]byte, 200)
+	copy(b[60:], kind)
+	binary.BigEndian.PutUint32(b[78:], 100)
+	copy(b[116:], "MOBI")
+	binary.BigEndian.PutUint32(b[136:], version)
+	return b
+}
+
+func TestSniffPalmDB(t *testing.T) {
+	tests := []struct {
+		name string
+		b []byte
+		want format.Format
+		ok bool
+	}{
+		{"mobi", palmDB("BOOKMOBI", 6), format.MOBI, true},
+		{"kf8", palmDB("BOOKMOBI", 8), format.AZW3, true},
+		{"palmdoc", palmDB("TEXtREAd", 0), 0, false},
+		{"short", []byte("BOOKMOBI"), 0, false},
+	}
+	for _, test := range tests {
+		f, ok := Sniff(bytes.NewReader(test.b), int64(len(test.b)))
+		if ok != test.ok || ok && f != test.want { t.Errorf("%s: got %v, %v, want %v, %v", test.name, f, ok, test.want, test.ok) }
+	}
+}
+
+func TestCheck(t *testing.T) {
+	pdf := []byte("%PDF-1.7\n")
+	tests := []struct {
+		filename string
+		b []byte
+		mismatch bool
+	}{
+		{"book.pdf", pdf, false},
+		{"book.epub", pdf, true},
+		{"book.mobi", palmDB("BOOKMOBI", 8), false},
+		{"book.azw3", palmDB("BOOKMOBI", 6), false},
+		{"book.txt", pdf, false},
+		// Extensions calibre-web accepts but format does not know are not checked
+		{"book.azw", palmDB("BOOKMOBI", 6), false},
+		{"book.prc", palmDB("BOOKMOBI", 6), false},
+		{"book.kepub", pdf, false},
+		{"book.djvu", []byte("AT&TFORM"), false},
+		{"audiobook.m4b", []byte("\x00\x00\x00\x20ftypM4B "), false},
+		{"audiobook.mp3", []byte("ID3\x03\x00"), false},
+		{"book.pdb", palmDB("TEXtREAd", 0), false},
+		// Content that is not detected is not checked
+		{"book.mobi", palmDB("TEXtREAd", 0), false},
+		{"book.epub", []byte("unknown"), false},
+	}
+	for _, test := range tests {
+		c, err := ContentFromReader(bytes.NewReader(test.b), test.filename, int64(len(test.b)), nil)
+		if err != nil { t.Fatal(err) }
+		err = Check(c)
+		var mismatch *FormatMismatchError
+		if test.mismatch != errors.As(err, &mismatch) || !test.mismatch && err != nil { t.Errorf("Check(%s) = %v", test.filename, err) }
+	}
+}
@@ -1,13 +1,23 @@
 package uploadcontent
 
 import (
-	"fmt"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
 	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
-	"github.com/mitchellh/ioprogress"
+	"github.com/yrhki/gocalibre/calibre-web/format"
+	"github.com/yrhki/gocalibre/calibre-web/progress"
 )
 
 type Content interface {
@@ -16,6 +26,10 @@ type Content interface {
 	Filename() string
 	Close() error
 	Reader() io.Reader
+	// Format returns the format detected from the contents
+	Format() (format.Format, bool)
+	// SHA256 returns the checksum of everything read from Reader so far
+	SHA256() []byte
 }
 
 type content struct {
@@ -23,61 +37,192 @@ type content struct {
 	size int64
 	contentType string
 	filename string
-	verbose bool
+	format format.Format
+	sniffed bool
+	progress progress.Reporter
 	uri string
+	hash hash.Hash
 }
 
 func (c *content) Close() error { return c.r.Close() }
 func (c *content) ContentType() string { return c.contentType }
 func (c *content) Filename() string { return c.filename }
 func (c *content) Size() int64 { return c.size }
+func (c *content) Format() (format.Format, bool) { return c.format, c.sniffed }
 
 func (c *content) Reader() io.Reader {
-	if c.verbose {
-		return &ioprogress.Reader{
-			Reader: c.r,
-			Size: c.size,
-			DrawFunc: ioprogress.DrawTerminalf(os.Stdout, func(progress, total int64) string {
-				return fmt.Sprintf("Uploading [%s]: %s", ioprogress.DrawTextFormatBytes(progress, total), c.uri)
-			}),
-		}
-	} else {
-		return c.r
-	}
+	c.hash = sha256.New()
+	return progress.Reader(io.TeeReader(c.r, c.hash), c.uri, c.size, c.progress)
+}
+
+func (c *content) SHA256() []byte {
+	if c.hash == nil { return nil }
+	return c.hash.Sum(nil)
 }
 
-func ContentFromResponse(resp *http.Response, verbose bool) Content {
+func ContentFromResponse(resp *http.Response, rep progress.Reporter) Content {
 	resp.Request.URL.RawQuery = ""
+	br := bufio.NewReaderSize(resp.Body, sniffLen)
+	// Read errors are returned again when reading the content
+	b, _ := br.Peek(sniffLen)
+	f, sniffed := SniffHeader(b)
+
+	contentType := resp.Header.Get("Content-Type")
+	if sniffed { contentType = f.ContentType() }
+
 	return &content{
-		r: resp.Body,
+		r: readCloser{br, resp.Body},
 		size: resp.ContentLength,
-		contentType: resp.Header.Get("Content-Type"),
+		contentType: contentType,
 		filename: filepath.Base(resp.Request.URL.Path),
+		format: f,
+		sniffed: sniffed,
 		uri: resp.Request.URL.Redacted(),
-		verbose: verbose,
+		progress: rep,
 	}
 }
 
-func ContentFromFile(file *os.File, verbose bool) (Content, error) {
-	// Detect ContentType
-	b := make([]byte, 512)
-	_, err := file.Read(b)
+func ContentFromFile(file *os.File, rep progress.Reporter) (Content, error) {
+	s, err := file.Stat()
 	if err != nil { return nil, err }
-	contentType := http.DetectContentType(b)
 
-	// Reset position
-	_, err = file.Seek(0, 0)
-	if err != nil { return nil, err }
+	// Detect ContentType
+	b := make([]byte, 512)
+	n, err := file.ReadAt(b, 0)
+	if err != nil && err != io.EOF { return nil, err }
+	contentType := http.DetectContentType(b[:n])
 
-	s, err := file.Stat()
-	if err != nil { return nil, err }
+	f, sniffed := Sniff(file, s.Size())
+	if sniffed { contentType = f.ContentType() }
 
 	return &content{
 		r: file,
 		size: s.Size(),
 		contentType: contentType,
 		filename: filepath.Base(file.Name()),
+		format: f,
+		sniffed: sniffed,
 		uri: file.Name(),
-		verbose: verbose,
+		progress: rep,
 	}, nil
 }
+
+// ContentFromReader wraps r as Content. The content type is detected from the
+// first bytes of r and if filename is empty one is derived from it.
+// A size of -1 means the size is unknown. r is closed with the Content if it is an io.Closer.
+func ContentFromReader(r io.Reader, filename string, size int64, rep progress.Reporter) (Content, error) {
+	br := bufio.NewReaderSize(r, sniffLen)
+	b, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull { return nil, err }
+	contentType := http.DetectContentType(b)
+
+	f, sniffed := SniffHeader(b)
+	c := ioutil.NopCloser(br)
+	if closer, ok := r.(io.Closer); ok { c = readCloser{br, closer} }
+
+	// Without filename the extension has to come from the format, and ZIP
+	// based formats like DOCX and CBZ can only be told apart from the whole
+	// file, which is spooled to a temporary file instead of memory
+	if filename == "" && !sniffed && bytes.HasPrefix(b, []byte("PK\x03\x04")) {
+		file, err := spool(br)
+		if closer, ok := r.(io.Closer); ok { closer.Close() }
+		if err != nil { return nil, err }
+		f, sniffed = Sniff(file, file.size)
+		c, size = file, file.size
+	}
+	if sniffed { contentType = f.ContentType() }
+
+	if filename == "" && sniffed {
+		filename = "upload." + f.Ext()
+	} else if filename == "" {
+		filename = "upload" + extension(contentType)
+	}
+
+	return &content{
+		r: c,
+		size: size,
+		contentType: contentType,
+		filename: filename,
+		format: f,
+		sniffed: sniffed,
+		uri: filename,
+		progress: rep,
+	}, nil
+}
+
+// ContentFromDataURI decodes a RFC 2397 data URI
+func ContentFromDataURI(uri string, rep progress.Reporter) (Content, error) {
+	if !strings.HasPrefix(uri, "data:") { return nil, errors.New("not a data URI") }
+	i := strings.IndexByte(uri, ',')
+	if i < 0 { return nil, errors.New("invalid data URI") }
+	header, data := uri[5:i], uri[i+1:]
+
+	isBase64 := strings.HasSuffix(header, ";base64")
+	header = strings.TrimSuffix(header, ";base64")
+
+	var b []byte
+	if isBase64 {
+		var err error
+		b, err = base64.StdEncoding.DecodeString(data)
+		if err != nil { return nil, err }
+	} else {
+		s, err := url.PathUnescape(data)
+		if err != nil { return nil, err }
+		b = []byte(s)
+	}
+
+	contentType := header
+	if mediatype, _, err := mime.ParseMediaType(header); err == nil { contentType = mediatype }
+
+	c, err := ContentFromReader(bytes.NewReader(b), "", int64(len(b)), rep)
+	if err != nil { return nil, err }
+	// The sniffed format is more reliable than the declared type
+	if _, sniffed := c.Format(); !sniffed && contentType != "" {
+		cc := c.(*content)
+		cc.contentType = contentType
+		if ext := extension(contentType); ext != "" || filepath.Ext(cc.filename) == "" { cc.filename = "upload" + ext }
+		cc.uri = "data:" + contentType
+	}
+	return c, nil
+}
+
+// tempFile is removed when it is closed
+type tempFile struct {
+	*os.File
+	size int64
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// spool copies r to a temporary file and rewinds it
+func spool(r io.Reader) (*tempFile, error) {
+	file, err := ioutil.TempFile("", "upload-*")
+	if err != nil { return nil, err }
+	f := &tempFile{File: file}
+	f.size, err = io.Copy(file, r)
+	if err == nil { _, err = file.Seek(0, io.SeekStart) }
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func extension(contentType string) string {
+	mediatype, _, err := mime.ParseMediaType(contentType)
+	if err != nil { return "" }
+	// Book types are often missing in the system MIME database
+	if f, ok := format.FromContentType(mediatype); ok { return "." + f.Ext() }
+	exts, err := mime.ExtensionsByType(mediatype)
+	if err != nil || len(exts) == 0 { return "" }
+	return exts[0]
+}
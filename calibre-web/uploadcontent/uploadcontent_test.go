@@ -0,0 +1,80 @@
+package uploadcontent
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func zipFile(t *testing.T, names ...string) []byte {
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, name := range names {
+		w, err := zw.Create(name)
+		if err != nil { t.Fatal(err) }
+		w.Write([]byte(name))
+	}
+	if err := zw.Close(); err != nil { t.Fatal(err) }
+	return buf.Bytes()
+}
+
+func TestContentFromReaderFilename(t *testing.T) {
+	docx := zipFile(t, "[Content_Types].xml", "word/document.xml")
+	tests := []struct {
+		name string
+		b []byte
+		want string
+	}{
+		{"docx", docx, "upload.docx"},
+		{"cbz", zipFile(t, "01.jpg", "02.png"), "upload.cbz"},
+		{"zip", zipFile(t, "notes.md"), "upload.zip"},
+		{"pdf", []byte("%PDF-1.7\n"), "upload.pdf"},
+		{"text", []byte("Chapter one\n"), "upload.txt"},
+	}
+	for _, test := range tests {
+		// Stdin is read with unknown size
+		c, err := ContentFromReader(ioutil.NopCloser(bytes.NewReader(test.b)), "", -1, nil)
+		if err != nil { t.Fatal(err) }
+		if c.Filename() != test.want { t.Errorf("%s: filename %q, want %q", test.name, c.Filename(), test.want) }
+		b, err := ioutil.ReadAll(c.Reader())
+		if err != nil { t.Fatal(err) }
+		if !bytes.Equal(b, test.b) { t.Errorf("%s: content changed", test.name) }
+	}
+
+	c, err := ContentFromReader(bytes.NewReader(docx), "", -1, nil)
+	if err != nil { t.Fatal(err) }
+	if c.Size() != int64(len(docx)) { t.Errorf("size %d of a buffered zip, want %d", c.Size(), len(docx)) }
+	if err = Check(c); err != nil { t.Errorf("Check: %v", err) }
+	// The zip is spooled to a temporary file, which goes away with the content
+	spooled, ok := c.(*content).r.(*tempFile)
+	if !ok { t.Fatalf("zip is read from %T", c.(*content).r) }
+	c.Close()
+	if _, err = os.Stat(spooled.Name()); !os.IsNotExist(err) { t.Errorf("%s kept after Close: %v", spooled.Name(), err) }
+
+	c, err = ContentFromReader(bytes.NewReader(docx), "book.cbz", -1, nil)
+	if err != nil { t.Fatal(err) }
+	if c.Filename() != "book.cbz" { t.Errorf("filename %q was replaced", c.Filename()) }
+}
+
+func TestContentFromDataURIFilename(t *testing.T) {
+	docx := base64.StdEncoding.EncodeToString(zipFile(t, "[Content_Types].xml", "word/document.xml"))
+	tests := []struct {
+		uri, want, contentType string
+	}{
+		// The declared type of a sniffed format is ignored
+		{"data:application/zip;base64," + docx, "upload.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"data:;base64," + docx, "upload.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"data:application/x-mobipocket-ebook,unknown", "upload.mobi", "application/x-mobipocket-ebook"},
+		{"data:text/plain;charset=utf-8,Chapter%20one", "upload.txt", "text/plain"},
+		{"data:application/x-unknown-type,Chapter%20one", "upload.txt", "application/x-unknown-type"},
+	}
+	for _, test := range tests {
+		c, err := ContentFromDataURI(test.uri, nil)
+		if err != nil { t.Fatal(err) }
+		if c.Filename() != test.want { t.Errorf("%.40s: filename %q, want %q", test.uri, c.Filename(), test.want) }
+		if c.ContentType() != test.contentType { t.Errorf("%.40s: content type %q, want %q", test.uri, c.ContentType(), test.contentType) }
+	}
+}
@@ -0,0 +1,302 @@
+package calibre
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+type Role uint16
+
+const (
+	RoleAdmin Role = 1 << iota
+	RoleDownload
+	RoleUpload
+	RoleEdit
+	RolePasswd
+	RoleAnonymous
+	RoleEditShelfs
+	RoleDelete
+	RoleViewer
+)
+
+// roleFields are the checkbox names of the roles in the user form
+var roleFields = []struct {
+	role Role
+	field string
+	name string
+}{
+	{RoleAdmin, "admin_role", "admin"},
+	{RoleDownload, "download_role", "download"},
+	{RoleUpload, "upload_role", "upload"},
+	{RoleEdit, "edit_role", "edit"},
+	{RolePasswd, "passwd_role", "passwd"},
+	{RoleEditShelfs, "edit_shelf_role", "shelfs"},
+	{RoleDelete, "delete_role", "delete"},
+	{RoleViewer, "viewer_role", "viewer"},
+}
+
+func (r Role) Has(role Role) bool { return r & role == role }
+
+func (r Role) String() string {
+	names := []string{}
+	for _, f := range roleFields {
+		if r.Has(f.role) { names = append(names, f.name) }
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseRole parses a comma separated list of role names as returned by Role.String
+func ParseRole(s string) (Role, error) {
+	var r Role
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" { continue }
+		found := false
+		for _, f := range roleFields {
+			if f.name == name {
+				r |= f.role
+				found = true
+			}
+		}
+		if !found { return 0, fmt.Errorf("unknown role %q", name) }
+	}
+	return r, nil
+}
+
+type User struct {
+	id uint64
+	sidebar uint64
+
+	Name string
+	Email string
+	KindleEmail string
+	Role Role
+	Locale string
+	DefaultLanguage string
+	AllowedTags []string
+	DeniedTags []string
+	// Password is only sent if it is not empty
+	Password string
+}
+
+func (user *User) ID() uint64 { return user.id }
+
+type userResponse struct {
+	ID uint64 `json:"id"`
+	Name string `json:"name"`
+	Email string `json:"email"`
+	KindleMail string `json:"kindle_mail"`
+	Role Role `json:"role"`
+	Locale string `json:"locale"`
+	DefaultLanguage string `json:"default_language"`
+	SidebarView uint64 `json:"sidebar_view"`
+	AllowedTags string `json:"allowed_tags"`
+	DeniedTags string `json:"denied_tags"`
+}
+
+type userListResponse struct {
+	Total int `json:"total"`
+	Rows []userResponse `json:"rows"`
+}
+
+func splitTags(s string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" { tags = append(tags, tag) }
+	}
+	return tags
+}
+
+func (api *API) ListUsers() ([]*User, error) {
+	users := []*User{}
+	for {
+		resp, err := api.c.Get(fmt.Sprintf("%s/ajax/listusers?offset=%d&limit=100", api.url, len(users)))
+		if err != nil { return nil, err }
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			return nil, errors.New(resp.Status)
+		}
+
+		list := new(userListResponse)
+		err = json.NewDecoder(resp.Body).Decode(list)
+		resp.Body.Close()
+		if err != nil { return nil, err }
+
+		for _, u := range list.Rows {
+			users = append(users, &User{
+				id: u.ID,
+				sidebar: u.SidebarView,
+				Name: u.Name,
+				Email: u.Email,
+				KindleEmail: u.KindleMail,
+				Role: u.Role,
+				Locale: u.Locale,
+				DefaultLanguage: u.DefaultLanguage,
+				AllowedTags: splitTags(u.AllowedTags),
+				DeniedTags: splitTags(u.DeniedTags),
+			})
+		}
+		if len(list.Rows) == 0 || len(users) >= list.Total { break }
+	}
+	return users, nil
+}
+
+func (api *API) UserByID(id uint64) (*User, error) {
+	users, err := api.ListUsers()
+	if err != nil { return nil, err }
+	for _, user := range users {
+		if user.id == id { return user, nil }
+	}
+	return nil, ErrUserNotFound
+}
+
+func (api *API) UserByName(name string) (*User, error) {
+	users, err := api.ListUsers()
+	if err != nil { return nil, err }
+	for _, user := range users {
+		if strings.EqualFold(user.Name, name) { return user, nil }
+	}
+	return nil, ErrUserNotFound
+}
+
+func (user *User) form() url.Values {
+	data := url.Values{
+		"name": {user.Name},
+		"email": {user.Email},
+		"kindle_mail": {user.KindleEmail},
+		"locale": {user.Locale},
+		"default_language": {user.DefaultLanguage},
+	}
+	if user.Password != "" { data.Set("password", user.Password) }
+	for _, f := range roleFields {
+		if user.Role.Has(f.role) { data.Set(f.field, "on") }
+	}
+	// The sidebar is saved from the same form and would be reset if missing
+	for bit := uint64(1); bit <= user.sidebar; bit <<= 1 {
+		if user.sidebar & bit != 0 { data.Set(fmt.Sprintf("show_%d", bit), "on") }
+	}
+	return data
+}
+
+// defaultSidebar reads the sidebar entries checked by default for new users
+func (api *API) defaultSidebar() (uint64, error) {
+	resp, err := api.c.Get(api.url + "/admin/user/new")
+	if err != nil { return 0, err }
+	defer resp.Body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil { return 0, err }
+
+	var sidebar uint64
+	doc.Find(`input[name^="show_"][checked]`).Each(func(_ int, s *goquery.Selection) {
+		name, _ := s.Attr("name")
+		if bit, err := strconv.ParseUint(name[5:], 10, 64); err == nil { sidebar |= bit }
+	})
+	return sidebar, nil
+}
+
+// CreateUser creates user, which needs a Password, and sets its tag restrictions
+func (api *API) CreateUser(user *User) (*User, error) {
+	if user.Password == "" { return nil, errors.New("password is required") }
+
+	sidebar, err := api.defaultSidebar()
+	if err != nil { return nil, err }
+	u := *user
+	u.sidebar = sidebar
+
+	resp, err := api.c.PostForm(api.url + "/admin/user/new", u.form())
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	err = checkFlashAlert(resp)
+	if err != nil { return nil, err }
+
+	created, err := api.UserByName(user.Name)
+	if err != nil { return nil, err }
+	err = api.setRestrictions(created.id, nil, nil, user.AllowedTags, user.DeniedTags)
+	if err != nil { return nil, err }
+	created.AllowedTags, created.DeniedTags = user.AllowedTags, user.DeniedTags
+	return created, nil
+}
+
+// UpdateUser saves all fields of a user returned by ListUsers or UserByID
+func (api *API) UpdateUser(user *User) error {
+	current, err := api.UserByID(user.id)
+	if err != nil { return err }
+
+	resp, err := api.c.PostForm(fmt.Sprintf("%s/admin/user/%d", api.url, user.id), user.form())
+	if err != nil { return err }
+	defer resp.Body.Close()
+	err = checkFlashAlert(resp)
+	if err != nil { return err }
+
+	return api.setRestrictions(user.id,
+		diffTags(current.AllowedTags, user.AllowedTags), diffTags(current.DeniedTags, user.DeniedTags),
+		diffTags(user.AllowedTags, current.AllowedTags), diffTags(user.DeniedTags, current.DeniedTags))
+}
+
+// diffTags returns the tags of a that are not in b
+func diffTags(a, b []string) []string {
+	diff := []string{}
+	for _, tag := range a {
+		found := false
+		for _, t := range b {
+			if t == tag { found = true }
+		}
+		if !found { diff = append(diff, tag) }
+	}
+	return diff
+}
+
+// setRestrictions removes and adds allowed and denied tags of a user
+func (api *API) setRestrictions(user uint64, removeAllowed, removeDenied, allowed, denied []string) error {
+	for _, tag := range removeAllowed {
+		err := api.postRestriction("deleterestriction", user, url.Values{"id": {"a0"}, "Element": {tag}})
+		if err != nil { return err }
+	}
+	for _, tag := range removeDenied {
+		err := api.postRestriction("deleterestriction", user, url.Values{"id": {"d0"}, "Element": {tag}})
+		if err != nil { return err }
+	}
+	for _, tag := range allowed {
+		err := api.postRestriction("addrestriction", user, url.Values{"add_value": {tag}, "submit_allow": {"on"}})
+		if err != nil { return err }
+	}
+	for _, tag := range denied {
+		err := api.postRestriction("addrestriction", user, url.Values{"add_value": {tag}, "submit_deny": {"on"}})
+		if err != nil { return err }
+	}
+	return nil
+}
+
+// postRestriction edits the tag restrictions of a user, type 2 are user tag
+// restrictions. Without the user in the path calibre-web edits the current user.
+func (api *API) postRestriction(endpoint string, user uint64, data url.Values) error {
+	resp, err := api.c.PostForm(fmt.Sprintf("%s/ajax/%s/2/%d", api.url, endpoint, user), data)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 { return fmt.Errorf("%s: %s", endpoint, resp.Status) }
+	return nil
+}
+
+func (api *API) DeleteUser(id uint64) error {
+	resp, err := api.c.PostForm(fmt.Sprintf("%s/admin/user/%d", api.url, id), url.Values{"delete": {"1"}})
+	if err != nil { return err }
+	defer resp.Body.Close()
+	return checkFlashAlert(resp)
+}
+
+// ResetPassword makes calibre-web generate a new password and mail it to the user
+func (api *API) ResetPassword(id uint64) error {
+	resp, err := api.c.PostForm(fmt.Sprintf("%s/admin/resetpassword/%d", api.url, id), nil)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	return checkFlashAlert(resp)
+}
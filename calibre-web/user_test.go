@@ -0,0 +1,44 @@
+package calibre
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUpdateUserRestrictions(t *testing.T) {
+	restrictions := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/ajax/listusers":
+			fmt.Fprint(w, `{"total": 2, "rows": [
+{"id": 1, "name": "admin", "role": 1, "allowed_tags": "", "denied_tags": ""},
+{"id": 5, "name": "bob", "role": 0, "allowed_tags": "Fantasy,Humour", "denied_tags": ""}]}`)
+		case r.URL.Path == "/admin/user/5":
+		case strings.HasPrefix(r.URL.Path, "/ajax/"):
+			r.ParseForm()
+			restrictions = append(restrictions, r.URL.Path + " " + r.PostForm.Encode())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	api, err := NewAPI(server.URL)
+	if err != nil { t.Fatal(err) }
+
+	user, err := api.UserByID(5)
+	if err != nil { t.Fatal(err) }
+	user.AllowedTags = []string{"Humour", "Science Fiction"}
+	user.DeniedTags = []string{"Horror"}
+	if err = api.UpdateUser(user); err != nil { t.Fatal(err) }
+
+	want := []string{
+		"/ajax/deleterestriction/2/5 Element=Fantasy&id=a0",
+		"/ajax/addrestriction/2/5 add_value=Science+Fiction&submit_allow=on",
+		"/ajax/addrestriction/2/5 add_value=Horror&submit_deny=on",
+	}
+	if !reflect.DeepEqual(restrictions, want) { t.Errorf("got requests\n%s\nwant\n%s", strings.Join(restrictions, "\n"), strings.Join(want, "\n")) }
+}
@@ -5,14 +5,25 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
 var (
 	ErrNotFound = errors.New("format not found")
+	ErrBookNotFound = errors.New("book not found")
 )
 
+type ChecksumError struct {
+	Expected, Actual []byte
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch: expected %x, got %x", e.Expected, e.Actual)
+}
+
 func noRedirect(req *http.Request, via []*http.Request) error {
 	return http.ErrUseLastResponse
 }
@@ -29,7 +40,7 @@ func checkFlashAlert(resp *http.Response) error {
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil { return err }
 
-	if flash := doc.Find("#flash_alert"); len(flash.Nodes) > 0 {
+	if flash := doc.Find("#flash_alert, #flash_danger"); len(flash.Nodes) > 0 {
 		return errors.New(flash.Text())
 	}
 
@@ -39,3 +50,23 @@ func checkFlashAlert(resp *http.Response) error {
 
 	return nil
 }
+
+var fileSizeUnits = map[string]float64{
+	"byte": 1, "bytes": 1, "b": 1,
+	"kb": 1e3, "mb": 1e6, "gb": 1e9, "tb": 1e12,
+	"kib": 1 << 10, "mib": 1 << 20, "gib": 1 << 30, "tib": 1 << 40,
+}
+
+// parseFileSize parses a size like "1.2 MB" in parentheses, as
+// shown next to the formats on the book page
+func parseFileSize(s string) (int64, bool) {
+	start, end := strings.LastIndex(s, "("), strings.LastIndex(s, ")")
+	if start < 0 || end < start { return 0, false }
+	fields := strings.Fields(s[start+1:end])
+	if len(fields) != 2 { return 0, false }
+	n, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil { return 0, false }
+	unit, ok := fileSizeUnits[strings.ToLower(fields[1])]
+	if !ok { return 0, false }
+	return int64(n * unit), true
+}
@@ -4,12 +4,15 @@ import (
 	"fmt"
 
 	"github.com/yrhki/gocalibre/calibre-web"
+	"github.com/yrhki/gocalibre/calibre-web/convert"
 )
 
 
 
-func listBook(api *calibre.API) {
-	books, err := api.ListBooks()
+func listBook(api *calibre.API) { listBooks(api.ListBooks) }
+
+func listBooks(load func() ([]*calibre.ListBook, error)) {
+	books, err := load()
 	must(err, "loading books", nil)
 
 	l := fmt.Sprint(len(fmt.Sprint(len(books))))
@@ -66,3 +69,30 @@ func uploadFile(api *calibre.API, uri string, formats []string) (*calibre.Book,
 
 	return book, nil
 }
+
+func markRead(api *calibre.API, read bool, ids []uint64) {
+	for _, id := range ids {
+		must(api.MarkRead(id, read), fmt.Sprintf("marking book %d", id), nil)
+	}
+}
+
+func setArchived(api *calibre.API, archived bool, ids []uint64) {
+	for _, id := range ids {
+		must(api.SetArchived(id, archived), fmt.Sprintf("archiving book %d", id), nil)
+	}
+}
+
+// convertTargets parses the comma separated formats to convert to and finds
+// ebook-convert
+func convertTargets(formats, ebookConvert string) (convert.Converter, []calibre.Format) {
+	targets := []calibre.Format{}
+	for _, ext := range splitList(formats) {
+		format, ok := calibre.FormatFromExt(ext)
+		if !ok { exitMessage("unknown format " + ext) }
+		targets = append(targets, format)
+	}
+
+	converter, err := convert.NewEbookConvert(ebookConvert)
+	must(err, "finding converter", nil)
+	return converter, targets
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/yrhki/gocalibre/calibre-web"
+)
+
+const configUsage = "usage: clibrecli config <get [-o FILE]|diff FILE|set FILE>"
+
+func loadConfig(path string) *calibre.ServerConfig {
+	b, err := ioutil.ReadFile(path)
+	must(err, "reading config", nil)
+	cfg := new(calibre.ServerConfig)
+	must(json.Unmarshal(b, cfg), "parsing config", nil)
+	return cfg
+}
+
+func configCommand(api *calibre.API, args []string) {
+	if len(args) == 0 { exitMessage(configUsage) }
+
+	fset := flag.NewFlagSet("config " + args[0], flag.ExitOnError)
+	output := fset.String("o", "", "output file")
+	fset.Parse(args[1:])
+
+	current, err := api.ServerConfig()
+	must(err, "loading server config", nil)
+
+	switch args[0] {
+	case "get":
+		b, err := json.MarshalIndent(current, "", "\t")
+		must(err, "encoding config", nil)
+		if *output == "" {
+			fmt.Println(string(b))
+		} else {
+			must(ioutil.WriteFile(*output, append(b, '\n'), 0600), "writing config", nil)
+		}
+	case "diff":
+		if fset.Arg(0) == "" { exitMessage(configUsage) }
+		changes := calibre.DiffConfig(current, loadConfig(fset.Arg(0)))
+		for _, c := range changes { fmt.Println(c) }
+		if len(changes) > 0 { os.Exit(1) }
+	case "set":
+		if fset.Arg(0) == "" { exitMessage(configUsage) }
+		cfg := loadConfig(fset.Arg(0))
+		changes := calibre.DiffConfig(current, cfg)
+		if len(changes) == 0 {
+			fmt.Println("Config is up to date")
+			return
+		}
+		for _, c := range changes { fmt.Println(c) }
+		if prompt(false, "Apply changes") { must(api.UpdateServerConfig(cfg), "updating server config", nil) }
+	default:
+		exitMessage(configUsage)
+	}
+}
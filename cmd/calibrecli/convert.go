@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/yrhki/gocalibre/calibre-web"
+)
+
+const convertUsage = "usage: clibrecli convert <BOOKID> -to FORMAT [-from FORMAT] [-o FILE]"
+
+// convertCommand converts a format on the server and waits until the book has it
+func convertCommand(api *calibre.API, args []string) {
+	fset := flag.NewFlagSet("convert", flag.ExitOnError)
+	fromExt := fset.String("from", "epub", "source format")
+	toExt := fset.String("to", "", "target format")
+	output := fset.String("o", "", "download the converted format to FILE")
+	fset.Parse(args)
+	if fset.Arg(0) == "" { exitMessage(convertUsage) }
+	idArg := fset.Arg(0)
+	fset.Parse(fset.Args()[1:])
+
+	id, err := strconv.ParseUint(idArg, 10, 0)
+	must(err, "parsing BOOKID", nil)
+	from, ok := calibre.FormatFromExt(*fromExt)
+	if !ok { exitMessage("unknown format " + *fromExt) }
+	to, ok := calibre.FormatFromExt(*toExt)
+	if !ok { exitMessage(convertUsage) }
+
+	ctx := context.Background()
+	task, err := api.ConvertFormat(id, from, to)
+	must(err, "queueing conversion", nil)
+	fmt.Printf("Queued task %s: %s\n", task.ID, task.Message)
+	task, err = api.WaitTask(ctx, task)
+	must(err, "converting", nil)
+
+	book, err := api.BookByID(id)
+	must(err, "loading book", nil)
+	if !book.HasFormat(to) { exitMessage(fmt.Sprintf("book %d has no %s after conversion", id, to)) }
+	fmt.Printf("Converted %s to %s\n", from, to)
+
+	if *output == "" { return }
+	file, err := os.Create(*output)
+	must(err, "creating output file", nil)
+	_, err = api.DownloadFormatTo(ctx, id, to, file, nil)
+	must(err, "downloading", func() { file.Close() })
+	must(file.Close(), "closing output file", nil)
+}
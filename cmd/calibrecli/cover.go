@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/yrhki/gocalibre/calibre-web"
+	"github.com/yrhki/gocalibre/calibre-web/uploadcontent"
+)
+
+const coverUsage = "usage: clibrecli cover <get [-o FILE] [-size sm|md|og] BOOKID|set [-max WxH] [-jpeg] BOOKID <FILEPATH|URL>|extract [-o FILE] [-set BOOKID] BOOKFILE>"
+
+func parseSize(s string) (int, int, error) {
+	if s == "" { return 0, 0, nil }
+	sp := strings.SplitN(s, "x", 2)
+	if len(sp) != 2 { return 0, 0, fmt.Errorf("invalid size %q", s) }
+	w, err := strconv.Atoi(sp[0])
+	if err != nil { return 0, 0, err }
+	h, err := strconv.Atoi(sp[1])
+	if err != nil { return 0, 0, err }
+	return w, h, nil
+}
+
+func coverCommand(api *calibre.API, args []string) {
+	if len(args) == 0 { exitMessage(coverUsage) }
+
+	fset := flag.NewFlagSet("cover " + args[0], flag.ExitOnError)
+	output := fset.String("o", "", "output file")
+	maxSize := fset.String("max", "", "downscale cover to fit WIDTHxHEIGHT")
+	toJPEG := fset.Bool("jpeg", false, "convert cover to JPEG")
+	setID := fset.Uint64("set", 0, "set the extracted cover on this book")
+	thumbnail := fset.String("size", "og", "thumbnail size: sm, md or og")
+	fset.Parse(args[1:])
+
+	var opts calibre.CoverOptions
+	var err error
+	opts.MaxWidth, opts.MaxHeight, err = parseSize(*maxSize)
+	must(err, "parsing -max", nil)
+	opts.JPEG = *toJPEG
+
+	switch args[0] {
+	case "get":
+		id, err := strconv.ParseUint(fset.Arg(0), 10, 0)
+		must(err, "parsing BOOKID", nil)
+
+		var size calibre.CoverSize
+		switch *thumbnail {
+		case "sm":
+			size = calibre.CoverSmall
+		case "md":
+			size = calibre.CoverMedium
+		case "og":
+			size = calibre.CoverOriginal
+		default:
+			exitMessage(coverUsage)
+		}
+
+		b, err := api.DownloadCoverSize(id, size)
+		must(err, "downloading cover", nil)
+		c, err := calibre.ReadCover(b)
+		must(err, "reading cover", nil)
+		if *output == "" { *output = fmt.Sprintf("%d.%s", id, c.Ext()) }
+		must(ioutil.WriteFile(*output, c.Data, 0644), "writing cover", nil)
+		fmt.Printf("%s: %dx%d %s\n", *output, c.Width, c.Height, c.ContentType)
+	case "set":
+		id, err := strconv.ParseUint(fset.Arg(0), 10, 0)
+		must(err, "parsing BOOKID", nil)
+		uri := fset.Arg(1)
+		if uri == "" { exitMessage(coverUsage) }
+
+		if strings.HasPrefix(uri, "http") && opts == (calibre.CoverOptions{}) {
+			must(api.UpdateBookCover(id, uri), "uploading cover", nil)
+			fmt.Println("Uploaded cover:", uri)
+			break
+		}
+
+		// The cover is processed locally, so URLs are downloaded first
+		var r io.Reader
+		if strings.HasPrefix(uri, "http") {
+			c, err := api.FetchCover(context.Background(), uri)
+			must(err, "downloading cover", nil)
+			r = bytes.NewReader(c.Data)
+		} else {
+			file, err := os.Open(uri)
+			must(err, "opening cover", nil)
+			defer file.Close()
+			r = file
+		}
+		c, err := api.SetCover(context.Background(), id, r, &opts)
+		must(err, "uploading cover", nil)
+		fmt.Printf("Uploaded cover: %dx%d %s\n", c.Width, c.Height, c.ContentType)
+	case "extract":
+		file, err := os.Open(fset.Arg(0))
+		must(err, "opening book", nil)
+		defer file.Close()
+		s, err := file.Stat()
+		must(err, "opening book", nil)
+
+		b, name, err := uploadcontent.ExtractCover(file, s.Size())
+		must(err, "extracting cover", nil)
+
+		if *setID != 0 {
+			c, err := api.SetCover(context.Background(), *setID, bytes.NewReader(b), &opts)
+			must(err, "uploading cover", nil)
+			fmt.Printf("Uploaded cover: %dx%d %s\n", c.Width, c.Height, c.ContentType)
+			break
+		}
+
+		if *output == "" {
+			base := filepath.Base(fset.Arg(0))
+			*output = strings.TrimSuffix(base, filepath.Ext(base)) + filepath.Ext(name)
+		}
+		must(ioutil.WriteFile(*output, b, 0644), "writing cover", nil)
+		fmt.Println("Extracted cover:", *output)
+	default:
+		exitMessage(coverUsage)
+	}
+}
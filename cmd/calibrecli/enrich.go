@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/yrhki/gocalibre/calibre-web"
+	"github.com/yrhki/gocalibre/calibre-web/metadata/provider"
+)
+
+const enrichUsage = "usage: clibrecli enrich <BOOKID> [-providers openlibrary,google,file:PATH] [-fields FIELDS] [-record DIR|-replay DIR]"
+
+func providers(names string, c *http.Client) []provider.Provider {
+	list := []provider.Provider{}
+	for _, name := range splitList(names) {
+		switch {
+		case name == "openlibrary":
+			list = append(list, &provider.OpenLibrary{Client: c})
+		case name == "google":
+			list = append(list, &provider.GoogleBooks{Client: c, Key: os.Getenv("GOOGLE_BOOKS_KEY")})
+		case strings.HasPrefix(name, "file:"):
+			list = append(list, &provider.File{Path: strings.TrimPrefix(name, "file:")})
+		default:
+			exitMessage("unknown provider " + name)
+		}
+	}
+	return list
+}
+
+func printCandidate(i int, c provider.Candidate) {
+	fmt.Printf("%d) [%s] %s by %s\n", i, c.Source, c.Title, strings.Join(c.Authors, " & "))
+	if c.Publisher != "" { fmt.Printf("     publisher: %s\n", c.Publisher) }
+	if c.Published != nil { fmt.Printf("     published: %s\n", c.Published.Format("2006-01-02")) }
+	if len(c.Identifiers) > 0 { fmt.Printf("     identifiers: %v\n", c.Identifiers) }
+	if len(c.Tags) > 0 { fmt.Printf("     tags: %s\n", strings.Join(c.Tags, ", ")) }
+}
+
+// enrichCommand looks up a book with metadata providers and merges the chosen candidate.
+// -record saves the provider responses, -replay answers them from such a recording.
+func enrichCommand(api *calibre.API, args []string) {
+	fset := flag.NewFlagSet("enrich", flag.ExitOnError)
+	names := fset.String("providers", "openlibrary,google", "comma separated providers: openlibrary, google, file:PATH")
+	fields := fset.String("fields", strings.Join(calibre.DefaultMetadataFields, ","), "comma separated fields to merge: " + strings.Join(calibre.MetadataFields, ", "))
+	cover := fset.Bool("cover", false, "also set the cover of the candidate")
+	record := fset.String("record", "", "record provider responses to DIR")
+	replay := fset.String("replay", "", "answer provider requests from recordings in DIR")
+	fset.Parse(args)
+	if fset.Arg(0) == "" { exitMessage(enrichUsage) }
+	idArg := fset.Arg(0)
+	fset.Parse(fset.Args()[1:])
+
+	id, err := strconv.ParseUint(idArg, 10, 0)
+	must(err, "parsing BOOKID", nil)
+
+	c := &http.Client{}
+	if *record != "" { c.Transport = &provider.Recorder{Dir: *record} }
+	if *replay != "" { c.Transport = &provider.Replay{Dir: *replay} }
+
+	book, err := api.BookByID(id)
+	must(err, "loading book", nil)
+	query := calibre.MetadataQuery(book)
+	fmt.Printf("Looking up %s\n", query)
+
+	candidates, errs := provider.LookupAll(context.Background(), providers(*names, c), query)
+	for _, err := range errs { fmt.Fprintln(os.Stderr, "WARN:", err) }
+	if len(candidates) == 0 { exitMessage("no candidates found") }
+	for i, candidate := range candidates { printCandidate(i + 1, candidate) }
+
+	var input string
+	fmt.Printf(":: Candidate to merge [1-%d, empty to cancel] ", len(candidates))
+	fmt.Scanln(&input)
+	n, err := strconv.Atoi(input)
+	if err != nil || n < 1 || n > len(candidates) { return }
+	candidate := candidates[n-1]
+
+	changed, err := calibre.MergeCandidate(book, candidate, splitList(*fields))
+	must(err, "merging metadata", nil)
+	if len(changed) == 0 && !*cover {
+		fmt.Println("Nothing to change")
+		return
+	}
+	fmt.Printf("Changed fields: %s\n", strings.Join(changed, ", "))
+	if !prompt(true, "Update book") { return }
+
+	must(api.UpdateBookMetadata(book), "updating metadata", nil)
+	if *cover && candidate.CoverURL != "" {
+		must(api.UpdateBookCover(id, candidate.CoverURL), "updating cover", nil)
+	}
+	fmt.Println("Updated book:", book.Title)
+}
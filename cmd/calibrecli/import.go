@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yrhki/gocalibre/calibre-web"
+	"github.com/yrhki/gocalibre/calibre-web/progress"
+)
+
+const (
+	importDone   = "done"
+	importFailed = "failed"
+)
+
+// Formats earlier in the list are preferred as the primary upload of a book
+var importPreference = []calibre.Format{
+	calibre.FormatEPUB,
+	calibre.FormatAZW3,
+	calibre.FormatMOBI,
+	calibre.FormatPDF,
+}
+
+type importGroup struct {
+	key   string
+	files []string
+}
+
+type importEntry struct {
+	Status   string   `json:"status"`
+	BookID   uint64   `json:"book_id,omitempty"`
+	Uploaded []string `json:"uploaded,omitempty"`
+	// Checksums maps format extensions to the hex SHA-256 of the uploaded file
+	Checksums map[string]string `json:"checksums,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+func (e *importEntry) addChecksums(book *calibre.Book) {
+	for _, f := range calibre.Formats {
+		sum, ok := book.Checksum(f)
+		if !ok { continue }
+		if e.Checksums == nil { e.Checksums = map[string]string{} }
+		e.Checksums[f.Ext()] = hex.EncodeToString(sum)
+	}
+}
+
+type importManifest struct {
+	mu      sync.Mutex
+	path    string
+	Entries map[string]*importEntry `json:"entries"`
+}
+
+func loadManifest(path string) (*importManifest, error) {
+	m := &importManifest{path: path, Entries: map[string]*importEntry{}}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) { return m, nil }
+	if err != nil { return nil, err }
+	err = json.Unmarshal(b, m)
+	if err != nil { return nil, err }
+	if m.Entries == nil { m.Entries = map[string]*importEntry{} }
+	return m, nil
+}
+
+// entry returns a copy of the entry for key so workers don't share state
+func (m *importManifest) entry(key string) importEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.Entries[key]; ok { return *e }
+	return importEntry{}
+}
+
+// update stores the entry and writes the manifest to disk
+func (m *importManifest) update(key string, e importEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Entries[key] = &e
+
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil { return err }
+	tmp := m.path + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil { return err }
+	return os.Rename(tmp, m.path)
+}
+
+func formatRank(path string) int {
+	format, _ := calibre.FormatFromExt(filepath.Ext(path))
+	for i, f := range importPreference {
+		if f == format { return i }
+	}
+	return len(importPreference) + int(format)
+}
+
+// collectImport walks dir and groups the book files it contains
+func collectImport(dir string) ([]*importGroup, error) {
+	paths := []string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil { return err }
+		if strings.HasPrefix(d.Name(), ".") && path != dir {
+			if d.IsDir() { return filepath.SkipDir }
+			return nil
+		}
+		if d.IsDir() { return nil }
+		if _, ok := calibre.FormatFromExt(filepath.Ext(path)); !ok { return nil }
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil { return nil, err }
+	return groupImport(dir, paths)
+}
+
+// groupImport groups the files below dir sharing a basename in the same
+// directory, the preferred format of a group comes first
+func groupImport(dir string, paths []string) ([]*importGroup, error) {
+	groups := map[string]*importGroup{}
+	for _, path := range paths {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil { return nil, err }
+		key := strings.TrimSuffix(rel, filepath.Ext(rel))
+		g, ok := groups[key]
+		if !ok {
+			g = &importGroup{key: key}
+			groups[key] = g
+		}
+		g.files = append(g.files, path)
+	}
+
+	result := make([]*importGroup, 0, len(groups))
+	for _, g := range groups {
+		sort.SliceStable(g.files, func(i, j int) bool { return formatRank(g.files[i]) < formatRank(g.files[j]) })
+		result = append(result, g)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].key < result[j].key })
+	return result, nil
+}
+
+// pendingImport returns the groups the manifest doesn't record as done
+func pendingImport(m *importManifest, groups []*importGroup) []*importGroup {
+	pending := []*importGroup{}
+	for _, g := range groups {
+		if m.entry(g.key).Status != importDone { pending = append(pending, g) }
+	}
+	return pending
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s { return true }
+	}
+	return false
+}
+
+// importer is the part of the API importBook uses
+type importer interface {
+	UploadNotify(uri string, created func(id uint64) error) (*calibre.Book, error)
+	BookByID(id uint64) (*calibre.Book, error)
+	BookUploadFormat(book *calibre.Book, uri string) error
+}
+
+// importBook uploads all files of a group, continuing from the state recorded in the manifest
+func importBook(api importer, m *importManifest, g *importGroup) error {
+	e := m.entry(g.key)
+
+	var book *calibre.Book
+	var err error
+	if e.BookID == 0 {
+		// The ID is recorded before the book is loaded, so a retry never
+		// uploads it twice
+		book, err = api.UploadNotify(g.files[0], func(id uint64) error {
+			e.BookID = id
+			e.Uploaded = []string{filepath.Base(g.files[0])}
+			return m.update(g.key, e)
+		})
+		if err != nil { return err }
+		e.addChecksums(book)
+		err = m.update(g.key, e)
+		if err != nil { return err }
+	} else {
+		book, err = api.BookByID(e.BookID)
+		if err != nil { return err }
+	}
+
+	for _, file := range g.files {
+		if contains(e.Uploaded, filepath.Base(file)) { continue }
+		err = api.BookUploadFormat(book, file)
+		if err != nil { return err }
+		e.Uploaded = append(e.Uploaded, filepath.Base(file))
+		e.addChecksums(book)
+		err = m.update(g.key, e)
+		if err != nil { return err }
+	}
+	return nil
+}
+
+func importDir(api *calibre.API, args []string) {
+	fset := flag.NewFlagSet("import", flag.ExitOnError)
+	jobs := fset.Int("j", 4, "number of concurrent uploads")
+	manifestPath := fset.String("manifest", "", "manifest file (default DIR/.calibrecli-import.json)")
+	fset.Parse(args)
+	if fset.Arg(0) == "" || *jobs < 1 { exitMessage("usage: clibrecli import [-j N] [-manifest FILE] <DIR>") }
+
+	dir := fset.Arg(0)
+	if *manifestPath == "" { *manifestPath = filepath.Join(dir, ".calibrecli-import.json") }
+
+	m, err := loadManifest(*manifestPath)
+	must(err, "loading manifest", nil)
+
+	groups, err := collectImport(dir)
+	must(err, "reading directory", nil)
+
+	bars := progress.NewMulti(os.Stdout)
+	api.SetProgress(bars)
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		imported, skipped int
+		failed []string
+	)
+
+	queue := make(chan *importGroup)
+	for i := 0; i < *jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for g := range queue {
+				err := importBook(api, m, g)
+				e := m.entry(g.key)
+				if err != nil {
+					e.Status, e.Error = importFailed, err.Error()
+				} else {
+					e.Status, e.Error = importDone, ""
+				}
+				if uerr := m.update(g.key, e); uerr != nil && err == nil { err = uerr }
+
+				mu.Lock()
+				if err != nil {
+					failed = append(failed, g.key)
+					bars.Fprintln(os.Stderr, fmt.Sprintf("Failed: %s: %s", g.key, err))
+				} else {
+					imported++
+					bars.Println(fmt.Sprintf("Imported: %s (%d)", g.key, e.BookID))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	pending := pendingImport(m, groups)
+	skipped = len(groups) - len(pending)
+	for _, g := range pending { queue <- g }
+	close(queue)
+	wg.Wait()
+
+	fmt.Printf("Imported %d, skipped %d, failed %d\n", imported, skipped, len(failed))
+	for _, key := range failed { fmt.Fprintln(os.Stderr, "  failed:", key) }
+	if len(failed) > 0 { os.Exit(1) }
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/yrhki/gocalibre/calibre-web"
+)
+
+func TestGroupImport(t *testing.T) {
+	dir := filepath.Join("library", "import")
+	paths := []string{
+		filepath.Join(dir, "Pratchett", "Mort.pdf"),
+		filepath.Join(dir, "Pratchett", "Mort.mobi"),
+		filepath.Join(dir, "Pratchett", "Mort.epub"),
+		filepath.Join(dir, "Mort.txt"),
+		filepath.Join(dir, "Mort.azw3"),
+		filepath.Join(dir, "Sourcery.epub"),
+	}
+	groups, err := groupImport(dir, paths)
+	if err != nil { t.Fatal(err) }
+
+	want := []importGroup{
+		{"Mort", []string{paths[4], paths[3]}},
+		{filepath.Join("Pratchett", "Mort"), []string{paths[2], paths[1], paths[0]}},
+		{"Sourcery", []string{paths[5]}},
+	}
+	if len(groups) != len(want) { t.Fatalf("%d groups, want %d", len(groups), len(want)) }
+	for i, g := range groups {
+		if !reflect.DeepEqual(*g, want[i]) { t.Errorf("group %d is %v, want %v", i, *g, want[i]) }
+	}
+}
+
+// fakeImporter records the uploads and fails the upload of failFile
+type fakeImporter struct {
+	nextID uint64
+	failFile string
+	uploaded map[uint64][]string
+	loaded []uint64
+}
+
+func (f *fakeImporter) UploadNotify(uri string, created func(id uint64) error) (*calibre.Book, error) {
+	f.nextID++
+	f.uploaded[f.nextID] = []string{filepath.Base(uri)}
+	return &calibre.Book{}, created(f.nextID)
+}
+
+func (f *fakeImporter) BookByID(id uint64) (*calibre.Book, error) {
+	f.loaded = append(f.loaded, id)
+	return &calibre.Book{}, nil
+}
+
+func (f *fakeImporter) BookUploadFormat(book *calibre.Book, uri string) error {
+	if filepath.Base(uri) == f.failFile { return errors.New("upload failed") }
+	id := f.nextID
+	if len(f.loaded) > 0 { id = f.loaded[len(f.loaded)-1] }
+	f.uploaded[id] = append(f.uploaded[id], filepath.Base(uri))
+	return nil
+}
+
+func TestImportBookResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	m, err := loadManifest(path)
+	if err != nil { t.Fatal(err) }
+	mort := &importGroup{"Mort", []string{"Mort.epub", "Mort.mobi", "Mort.pdf"}}
+	sourcery := &importGroup{"Sourcery", []string{"Sourcery.epub"}}
+	err = m.update("Sourcery", importEntry{Status: importDone, BookID: 1, Uploaded: []string{"Sourcery.epub"}})
+	if err != nil { t.Fatal(err) }
+
+	pending := pendingImport(m, []*importGroup{mort, sourcery})
+	if len(pending) != 1 || pending[0] != mort { t.Fatalf("pending %v", pending) }
+
+	// The first run stops at the PDF
+	api := &fakeImporter{nextID: 1, failFile: "Mort.pdf", uploaded: map[uint64][]string{}}
+	if err = importBook(api, m, mort); err == nil { t.Fatal("failed upload was not returned") }
+
+	// The next run starts from the manifest on disk and only uploads the PDF
+	m, err = loadManifest(path)
+	if err != nil { t.Fatal(err) }
+	e := m.entry("Mort")
+	if e.BookID != 2 || !reflect.DeepEqual(e.Uploaded, []string{"Mort.epub", "Mort.mobi"}) { t.Fatalf("recorded %+v", e) }
+	api.failFile = ""
+	if err = importBook(api, m, mort); err != nil { t.Fatal(err) }
+
+	if !reflect.DeepEqual(api.loaded, []uint64{2}) { t.Errorf("loaded books %v, want [2]", api.loaded) }
+	if want := []string{"Mort.epub", "Mort.mobi", "Mort.pdf"}; !reflect.DeepEqual(api.uploaded[2], want) {
+		t.Errorf("uploaded %v, want %v", api.uploaded[2], want)
+	}
+	if len(api.uploaded) != 1 { t.Errorf("uploaded books %v", api.uploaded) }
+	if e = m.entry("Mort"); !reflect.DeepEqual(e.Uploaded, api.uploaded[2]) { t.Errorf("recorded %v", e.Uploaded) }
+}
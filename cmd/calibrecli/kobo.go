@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/yrhki/gocalibre/calibre-web/kobo"
+)
+
+const koboUsage = "usage: clibrecli kobo -token TOKEN <init|sync|state UUID|export FILE|import FILE>"
+
+// koboCommand talks to the Kobo sync endpoint as a device. export and import
+// move the reading states of one user to another by using their tokens.
+func koboCommand(serverURL string, args []string) {
+	fset := flag.NewFlagSet("kobo", flag.ExitOnError)
+	token := fset.String("token", os.Getenv("CALIBRE_KOBO_TOKEN"), "Kobo auth token from the calibre-web profile")
+	fset.Parse(args)
+	if *token == "" || fset.Arg(0) == "" { exitMessage(koboUsage) }
+
+	ctx := context.Background()
+	device := kobo.NewClient(serverURL, *token, nil)
+
+	switch fset.Arg(0) {
+	case "init":
+		resources, err := device.Initialize(ctx)
+		must(err, "initializing", nil)
+		fmt.Printf("%d resources\n", len(resources))
+	case "sync":
+		changes, err := device.SyncAll(ctx)
+		must(err, "syncing", nil)
+		for _, change := range changes {
+			switch {
+			case change.Entitlement != nil && change.Entitlement.BookMetadata != nil:
+				e := change.Entitlement
+				status := ""
+				if e.ReadingState != nil { status = e.ReadingState.StatusInfo.Status }
+				fmt.Printf("%s %s: %s [%s]\n", change.Kind, e.BookEntitlement.ID, e.BookMetadata.Title, status)
+			case change.ReadingState != nil:
+				fmt.Printf("%s %s: %s\n", change.Kind, change.ReadingState.EntitlementID, change.ReadingState.StatusInfo.Status)
+			default:
+				fmt.Println(change.Kind)
+			}
+		}
+	case "state":
+		if fset.Arg(1) == "" { exitMessage(koboUsage) }
+		state, err := device.ReadingState(ctx, fset.Arg(1))
+		must(err, "loading reading state", nil)
+		b, err := json.MarshalIndent(state, "", "\t")
+		must(err, "encoding reading state", nil)
+		fmt.Println(string(b))
+	case "export":
+		if fset.Arg(1) == "" { exitMessage(koboUsage) }
+		changes, err := device.SyncAll(ctx)
+		must(err, "syncing", nil)
+		states := kobo.ReadingStates(changes)
+		b, err := json.MarshalIndent(states, "", "\t")
+		must(err, "encoding reading states", nil)
+		must(ioutil.WriteFile(fset.Arg(1), append(b, '\n'), 0644), "writing reading states", nil)
+		fmt.Printf("Exported %d reading states\n", len(states))
+	case "import":
+		if fset.Arg(1) == "" { exitMessage(koboUsage) }
+		b, err := ioutil.ReadFile(fset.Arg(1))
+		must(err, "reading reading states", nil)
+		states := []*kobo.ReadingState{}
+		must(json.Unmarshal(b, &states), "parsing reading states", nil)
+
+		var failed int
+		now := time.Now()
+		for _, state := range states {
+			state.Touch(now)
+			if err := device.UpdateReadingState(ctx, state); err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "%s: %s\n", state.EntitlementID, err)
+			}
+		}
+		fmt.Printf("Imported %d, failed %d\n", len(states) - failed, failed)
+		if failed > 0 { os.Exit(1) }
+	default:
+		exitMessage(koboUsage)
+	}
+}
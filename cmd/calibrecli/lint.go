@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/yrhki/gocalibre/calibre-web"
+	"github.com/yrhki/gocalibre/calibre-web/lint"
+)
+
+const lintUsage = "usage: clibrecli lint [-format table|json|junit] [-o FILE] [-rules RULES] [-fix]"
+
+// lintCommand checks every book with the lint rules and exits with 1 if issues remain
+func lintCommand(api *calibre.API, args []string) {
+	fset := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := fset.String("format", "table", "output format: table, json or junit")
+	output := fset.String("o", "", "write the report to FILE")
+	names := fset.String("rules", "", "comma separated rules to run, all by default")
+	fix := fset.Bool("fix", false, "apply the safe fixes and report the remaining issues")
+	list := fset.Bool("list", false, "list the rules")
+	fset.Parse(args)
+
+	rules := lint.DefaultRules()
+	if *list {
+		for _, rule := range rules { fmt.Printf("%s: %s\n", rule.Name(), rule.Description()) }
+		return
+	}
+	if *names != "" {
+		selected := []lint.Rule{}
+		for _, name := range splitList(*names) {
+			found := false
+			for _, rule := range rules {
+				if rule.Name() == name {
+					selected = append(selected, rule)
+					found = true
+				}
+			}
+			if !found { exitMessage("unknown rule " + name) }
+		}
+		rules = selected
+	}
+
+	// Checked before -fix changes any book
+	switch *format {
+	case "table", "json", "junit":
+	default:
+		exitMessage(lintUsage)
+	}
+
+	books, err := lint.Load(context.Background(), api)
+	must(err, "loading books", nil)
+	issues := lint.Run(rules, books)
+
+	var fixErrs []error
+	if *fix {
+		var fixed []lint.Issue
+		fixed, fixErrs = lint.Fix(api, books, issues)
+		for _, err := range fixErrs { fmt.Fprintln(os.Stderr, "Error fixing", err) }
+		fmt.Fprintf(os.Stderr, "Fixed %d issues\n", len(fixed))
+		if len(fixed) > 0 { issues = lint.Run(rules, books) }
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		must(err, "creating report", nil)
+		defer file.Close()
+		w = file
+	}
+
+	switch *format {
+	case "table":
+		err = lint.WriteTable(w, issues)
+	case "json":
+		err = lint.WriteJSON(w, issues)
+	case "junit":
+		err = lint.WriteJUnit(w, rules, issues)
+	}
+	must(err, "writing report", nil)
+
+	fmt.Fprintf(os.Stderr, "Checked %d books, %d issues\n", len(books), len(issues))
+	if len(issues) > 0 || len(fixErrs) > 0 {
+		if file, ok := w.(*os.File); ok && file != os.Stdout { file.Close() }
+		os.Exit(1)
+	}
+}
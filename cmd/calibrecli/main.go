@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/yrhki/gocalibre/calibre-web"
+	"github.com/yrhki/gocalibre/calibre-web/convert"
+	"github.com/yrhki/gocalibre/calibre-web/progress"
 )
 
 var (
@@ -15,6 +21,7 @@ var (
 	flagUsername string
 	flagPassword string
 	flagLogin    bool
+	flagOPDS     bool
 )
 
 func must(err error, reason string, callback func()) {
@@ -34,21 +41,35 @@ func parseArgs() {
 	flag.StringVar(&flagUsername, "username", "", "username for calibre")
 	flag.StringVar(&flagPassword, "password", "", "username for calibre")
 	flag.StringVar(&flagURL, "url", "", "")
+	flag.BoolVar(&flagOPDS, "opds", false, "use the OPDS catalog for listing, search and downloads")
 	flag.Parse()
 
 	if v := os.Getenv("CALIBRE_PASSWORD"); v != "" { flagPassword = v }
 	if v := os.Getenv("CALIBRE_USERNAME"); v != "" { flagUsername = v }
 	if v := os.Getenv("CALIBRE_URL"); v != "" { flagURL = v }
 
-	if flagURL == "" { must(errors.New("empty URL"), "parsing arguments", nil) }
-
 	return
 }
 
 func main() {
 	parseArgs()
+	// The local catalog has to work while calibre-web is down
+	if flag.Arg(0) == "serve-opds" {
+		serveOPDS(flag.Args()[1:])
+		return
+	}
+	if flagURL == "" { must(errors.New("empty URL"), "parsing arguments", nil) }
+
+	// Kobo devices authenticate with their token only
+	if flag.Arg(0) == "kobo" {
+		koboCommand(flagURL, flag.Args()[1:])
+		return
+	}
+
 	api, err := calibre.NewAPI(flagURL)
 	must(err, "creating api instance", nil)
+	api.SetProgress(progress.Terminal(os.Stdout))
+	if flagOPDS { must(api.UseOPDS(flagUsername, flagPassword), "creating OPDS client", nil) }
 
 	must(api.Login(flagUsername, flagPassword), "login in", nil)
 	defer api.Logout()
@@ -66,9 +87,28 @@ func main() {
 			listSeries(api)
 		case "authors":
 			listAuthors(api)
+		case "read":
+			listBooks(api.ReadBooks)
+		case "unread":
+			listBooks(api.UnreadBooks)
+		case "archived":
+			listBooks(api.ArchivedBooks)
+		default:
+			exitMessage("usage: clibrecli list <book|lang|categories|series|authors|read|unread|archived>")
+		}
+	case "mark":
+		if flag.NArg() < 3 { exitMessage("usage: clibrecli mark <read|unread> <BOOKID> [BOOKID..]") }
+		switch flag.Arg(1) {
+		case "read":
+			markRead(api, true, parseIDs(flag.Args()[2:]))
+		case "unread":
+			markRead(api, false, parseIDs(flag.Args()[2:]))
 		default:
-			exitMessage("usage: clibrecli list <book|lang|categories|series|authors>")
+			exitMessage("usage: clibrecli mark <read|unread> <BOOKID> [BOOKID..]")
 		}
+	case "archive", "unarchive":
+		if flag.NArg() < 2 { exitMessage("usage: clibrecli <archive|unarchive> <BOOKID> [BOOKID..]") }
+		setArchived(api, flag.Arg(0) == "archive", parseIDs(flag.Args()[1:]))
 	case "delete":
 		if flag.Arg(1) == "" { exitMessage("usage: clibrecli delete <BOOKID>") }
 
@@ -81,13 +121,100 @@ func main() {
 
 		// TODO
 	case "upload":
-		if flag.Arg(1) == "" { exitMessage("usage: clibrecli upload <FILPATH> [FILEPATH..]") }
+		fset := flag.NewFlagSet("upload", flag.ExitOnError)
+		rollback := fset.Bool("rollback", false, "delete the book without prompting if any upload fails")
+		cover := fset.String("cover", "", "cover image path or URL")
+		convertTo := fset.String("convert-to", "", "comma separated formats to convert the first file to before uploading")
+		ebookConvert := fset.String("ebook-convert", "", "path of ebook-convert, found in PATH by default")
+		metadataPath := fset.String("metadata", "", "JSON file with book fields like Title and Authors to set")
+		fset.Parse(flag.Args()[1:])
+		if fset.Arg(0) == "" { exitMessage("usage: clibrecli upload [-rollback] [-cover FILEPATH] [-metadata FILE] [-convert-to FORMATS] <FILPATH> [FILEPATH..]") }
+
+		var metadata []byte
+		if *metadataPath != "" {
+			var err error
+			metadata, err = ioutil.ReadFile(*metadataPath)
+			must(err, "reading metadata", nil)
+			must(json.Unmarshal(metadata, new(calibre.Book)), "parsing metadata", nil)
+		}
+
+		var converter convert.Converter
+		var targets []calibre.Format
+		if *convertTo != "" { converter, targets = convertTargets(*convertTo, *ebookConvert) }
+
+		if *rollback {
+			spec := calibre.UploadSpec{
+				Primary: fset.Arg(0),
+				ExtraFormats: fset.Args()[1:],
+				Cover: *cover,
+				Converter: converter,
+				ConvertTo: targets,
+			}
+			if metadata != nil {
+				spec.Metadata = new(calibre.Book)
+				json.Unmarshal(metadata, spec.Metadata)
+			}
+			book, err := api.UploadBook(context.Background(), spec)
+			must(err, "uploading book", nil)
+			fmt.Println("Uploaded book:", book.Title)
+			break
+		}
 
-		b, err := uploadFile(api, flag.Arg(1), flag.Args()[2:])
-		must(err, "uploading book", func() {
-			if prompt(true, fmt.Sprintf("Delete book: %s (%d)", b.Title, b.ID())) {
+		b, err := uploadFile(api, fset.Arg(0), fset.Args()[1:])
+		deletePrompt := func() {
+			if b != nil && prompt(true, fmt.Sprintf("Delete book: %s (%d)", b.Title, b.ID())) {
 				deleteBook(api, b.ID())
 			}
-		})
+		}
+		must(err, "uploading book", deletePrompt)
+		if len(targets) > 0 {
+			err = api.UploadConverted(context.Background(), b, converter, fset.Arg(0), targets)
+			must(err, "uploading converted formats", deletePrompt)
+			fmt.Println("Uploaded converted formats:", *convertTo)
+		}
+		if *cover != "" {
+			must(api.UpdateBookCover(b.ID(), *cover), "uploading cover", nil)
+			fmt.Println("Uploaded cover:", *cover)
+		}
+		if metadata != nil {
+			// Fields missing from the file keep the detected value
+			json.Unmarshal(metadata, b)
+			must(api.UpdateBookMetadata(b), "updating metadata", nil)
+			fmt.Println("Updated metadata:", b.Title)
+		}
+	case "import":
+		importDir(api, flag.Args()[1:])
+	case "verify":
+		verifyManifest(api, flag.Args()[1:])
+	case "cover":
+		coverCommand(api, flag.Args()[1:])
+	case "shelf":
+		shelfCommand(api, flag.Args()[1:])
+	case "user":
+		userCommand(api, flag.Args()[1:])
+	case "config":
+		configCommand(api, flag.Args()[1:])
+	case "search":
+		if flag.NArg() < 2 { exitMessage("usage: clibrecli search <QUERY>") }
+		query := strings.Join(flag.Args()[1:], " ")
+		listBooks(func() ([]*calibre.ListBook, error) { return api.Search(context.Background(), query) })
+	case "send":
+		sendCommand(api, flag.Args()[1:])
+	case "convert":
+		convertCommand(api, flag.Args()[1:])
+	case "enrich":
+		enrichCommand(api, flag.Args()[1:])
+	case "lint":
+		lintCommand(api, flag.Args()[1:])
+	case "stats":
+		statsCommand(api, flag.Args()[1:])
+	case "info":
+		info, err := api.ServerInfo()
+		must(err, "loading server info", nil)
+		fmt.Printf("calibre-web %s\n", info.RawVersion)
+		if info.CalibreDir != "" { fmt.Printf("Calibre database: %s\n", info.CalibreDir) }
+		fmt.Printf("Books: %d, authors: %d, categories: %d, series: %d\n", info.Books, info.Authors, info.Categories, info.Series)
+		fmt.Printf("Capabilities: %s\n", info.Capabilities)
+		for _, name := range info.LibraryNames() { fmt.Printf("  %s: %s\n", name, info.Libraries[name]) }
 	}
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/yrhki/gocalibre/calibre-web"
+)
+
+const sendUsage = "usage: clibrecli send <BOOKID> [-format FORMAT] [-from MOBI|AZW3] [-wait]"
+
+func sendCommand(api *calibre.API, args []string) {
+	fset := flag.NewFlagSet("send", flag.ExitOnError)
+	formatExt := fset.String("format", "epub", "format to send")
+	fromExt := fset.String("from", "", "convert from this format, mobi or azw3, before sending")
+	wait := fset.Bool("wait", false, "wait until the email is sent, or the conversion with -from")
+	fset.Parse(args)
+	if fset.Arg(0) == "" { exitMessage(sendUsage) }
+	// Flags may also follow the book id
+	idArg := fset.Arg(0)
+	fset.Parse(fset.Args()[1:])
+
+	id, err := strconv.ParseUint(idArg, 10, 0)
+	must(err, "parsing BOOKID", nil)
+	format, ok := calibre.FormatFromExt(*formatExt)
+	if !ok { exitMessage("unknown format " + *formatExt) }
+	from := format
+	if *fromExt != "" {
+		from, ok = calibre.FormatFromExt(*fromExt)
+		if !ok { exitMessage("unknown format " + *fromExt) }
+	}
+
+	task, err := api.SendToEReader(id, format, from)
+	must(err, "sending book", nil)
+	fmt.Printf("Queued task %s: %s\n", task.ID, task.Message)
+	if !*wait { return }
+
+	task, err = api.WaitTask(context.Background(), task)
+	must(err, "sending book", nil)
+	fmt.Printf("Task %s: %s\n", task.ID, task.Status)
+	if from != format { fmt.Println("The email is queued as a new task") }
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+
+	"github.com/yrhki/gocalibre/calibre-web/library"
+)
+
+// serveOPDS publishes a mirrored library as OPDS catalog. With -upstream the
+// catalog of calibre-web is proxied while it is up and the mirror used otherwise.
+func serveOPDS(args []string) {
+	fset := flag.NewFlagSet("serve-opds", flag.ExitOnError)
+	addr := fset.String("addr", ":8080", "listen address")
+	title := fset.String("title", "Library", "catalog title")
+	upstream := fset.String("upstream", "", "calibre-web URL to proxy while it is reachable")
+	fset.Parse(args)
+	if fset.Arg(0) == "" { exitMessage("usage: clibrecli serve-opds [-addr ADDR] [-title TITLE] [-upstream URL] <LIBRARYDIR>") }
+
+	lib, err := library.Open(fset.Arg(0))
+	must(err, "loading library", nil)
+	for _, err := range lib.Skipped { fmt.Fprintln(os.Stderr, "Skipping book:", err) }
+	var handler http.Handler = library.NewServer(lib, *title)
+
+	if *upstream != "" {
+		target, err := url.Parse(*upstream)
+		must(err, "parsing upstream URL", nil)
+		local := handler
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			if resp.StatusCode >= 500 { return errors.New(resp.Status) }
+			return nil
+		}
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			fmt.Fprintf(os.Stderr, "upstream %s: %s, serving mirror\n", r.URL.Path, err)
+			local.ServeHTTP(w, r)
+		}
+		handler = proxy
+	}
+
+	fmt.Printf("Serving %d books on %s\n", len(lib.Books), *addr)
+	must(http.ListenAndServe(*addr, handler), "serving OPDS", nil)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yrhki/gocalibre/calibre-web"
+)
+
+const shelfUsage = "usage: clibrecli shelf <list|create [-public] NAME|rename SHELFID NAME|delete SHELFID|books SHELFID|add SHELFID BOOKID..|remove SHELFID BOOKID..|order SHELFID BOOKID..>"
+
+func parseIDs(args []string) []uint64 {
+	ids := make([]uint64, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 0)
+		must(err, "parsing ID " + arg, nil)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func shelfCommand(api *calibre.API, args []string) {
+	if len(args) == 0 { exitMessage(shelfUsage) }
+
+	fset := flag.NewFlagSet("shelf " + args[0], flag.ExitOnError)
+	public := fset.Bool("public", false, "make the shelf public")
+	fset.Parse(args[1:])
+
+	if args[0] == "list" {
+		shelves, err := api.ListShelves()
+		must(err, "loading shelves", nil)
+		for _, shelf := range shelves {
+			if shelf.Public {
+				fmt.Printf("%d: %s (public)\n", shelf.ID(), shelf.Name)
+			} else {
+				fmt.Printf("%d: %s\n", shelf.ID(), shelf.Name)
+			}
+		}
+		return
+	}
+
+	if args[0] == "create" {
+		if fset.NArg() == 0 { exitMessage(shelfUsage) }
+		shelf, err := api.CreateShelf(strings.Join(fset.Args(), " "), *public)
+		must(err, "creating shelf", nil)
+		fmt.Printf("Created shelf: %s (%d)\n", shelf.Name, shelf.ID())
+		return
+	}
+
+	if fset.NArg() == 0 { exitMessage(shelfUsage) }
+	ids := fset.Args()[1:]
+	id, err := strconv.ParseUint(fset.Arg(0), 10, 0)
+	must(err, "parsing SHELFID", nil)
+
+	switch args[0] {
+	case "rename":
+		if len(ids) == 0 { exitMessage(shelfUsage) }
+		must(api.RenameShelf(id, strings.Join(ids, " ")), "renaming shelf", nil)
+	case "delete":
+		if prompt(false, "Delete shelf") { must(api.DeleteShelf(id), "deleting shelf", nil) }
+	case "books":
+		books, err := api.ShelfBooks(id)
+		must(err, "loading shelf", nil)
+		for _, book := range books { fmt.Printf("%d: %s\n", book.ID(), book.Name()) }
+	case "add":
+		for _, book := range parseIDs(ids) {
+			must(api.AddToShelf(id, book), fmt.Sprintf("adding book %d", book), nil)
+		}
+	case "remove":
+		for _, book := range parseIDs(ids) {
+			must(api.RemoveFromShelf(id, book), fmt.Sprintf("removing book %d", book), nil)
+		}
+	case "order":
+		must(api.ReorderShelf(id, parseIDs(ids)), "ordering shelf", nil)
+	default:
+		exitMessage(shelfUsage)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/yrhki/gocalibre/calibre-web"
+)
+
+func formatSize(size int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	n, i := float64(size), 0
+	for ; n >= 1000 && i < len(units) - 1; i++ { n /= 1000 }
+	if i == 0 { return fmt.Sprintf("%d B", size) }
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+func statsCommand(api *calibre.API, args []string) {
+	fset := flag.NewFlagSet("stats", flag.ExitOnError)
+	top := fset.Int("top", 10, "number of top authors and tags")
+	asJSON := fset.Bool("json", false, "print JSON")
+	fset.Parse(args)
+
+	stats, err := api.Stats(context.Background(), *top)
+	must(err, "loading stats", nil)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		must(enc.Encode(stats), "encoding stats", nil)
+		return
+	}
+
+	fmt.Printf("Books: %d\nAuthors: %d\nTags: %d\nSeries: %d\n", stats.Books, stats.Authors, stats.Tags, stats.Series)
+	fmt.Printf("Total size: %s\n", formatSize(stats.Size))
+	fmt.Println("Formats:")
+	for _, format := range calibre.Formats {
+		if n := stats.Formats[format]; n > 0 { fmt.Printf("  %s: %d\n", format, n) }
+	}
+	fmt.Printf("Without cover: %d %v\n", len(stats.NoCover), stats.NoCover)
+	fmt.Printf("Without description: %d %v\n", len(stats.NoDescription), stats.NoDescription)
+	fmt.Printf("Without identifiers: %d %v\n", len(stats.NoIdentifiers), stats.NoIdentifiers)
+	fmt.Println("Top authors:")
+	for _, c := range stats.TopAuthors { fmt.Printf("  %s: %d\n", c.Name, c.Count) }
+	fmt.Println("Top tags:")
+	for _, c := range stats.TopTags { fmt.Printf("  %s: %d\n", c.Name, c.Count) }
+	for id, reason := range stats.Errors { fmt.Fprintf(os.Stderr, "Skipped book %d: %s\n", id, reason) }
+}
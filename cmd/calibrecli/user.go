@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/yrhki/gocalibre/calibre-web"
+)
+
+const userUsage = "usage: clibrecli user <list|create [FLAGS] NAME|update [FLAGS] USERID|delete USERID|reset USERID|import CSVFILE>"
+
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' }) {
+		if item = strings.TrimSpace(item); item != "" { list = append(list, item) }
+	}
+	return list
+}
+
+func userCommand(api *calibre.API, args []string) {
+	if len(args) == 0 { exitMessage(userUsage) }
+
+	fset := flag.NewFlagSet("user " + args[0], flag.ExitOnError)
+	email := fset.String("email", "", "email address")
+	kindle := fset.String("kindle", "", "Kindle email address")
+	password := fset.String("password", "", "password")
+	roles := fset.String("roles", "", "comma separated roles: admin,download,upload,edit,passwd,shelfs,delete,viewer")
+	locale := fset.String("locale", "", "UI language")
+	language := fset.String("lang", "", "default book language")
+	allow := fset.String("allow", "", "comma separated allowed tags")
+	deny := fset.String("deny", "", "comma separated denied tags")
+	fset.Parse(args[1:])
+
+	// apply sets the flags given on the command line
+	apply := func(user *calibre.User) {
+		fset.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "email":
+				user.Email = *email
+			case "kindle":
+				user.KindleEmail = *kindle
+			case "password":
+				user.Password = *password
+			case "roles":
+				role, err := calibre.ParseRole(*roles)
+				must(err, "parsing roles", nil)
+				user.Role = role
+			case "locale":
+				user.Locale = *locale
+			case "lang":
+				user.DefaultLanguage = *language
+			case "allow":
+				user.AllowedTags = splitList(*allow)
+			case "deny":
+				user.DeniedTags = splitList(*deny)
+			}
+		})
+	}
+
+	switch args[0] {
+	case "list":
+		users, err := api.ListUsers()
+		must(err, "loading users", nil)
+		for _, user := range users {
+			fmt.Printf("%d: %s <%s> [%s]\n", user.ID(), user.Name, user.Email, user.Role)
+		}
+	case "create":
+		if fset.Arg(0) == "" { exitMessage(userUsage) }
+		user := &calibre.User{Name: fset.Arg(0)}
+		apply(user)
+		created, err := api.CreateUser(user)
+		must(err, "creating user", nil)
+		fmt.Printf("Created user: %s (%d)\n", created.Name, created.ID())
+	case "update":
+		id, err := strconv.ParseUint(fset.Arg(0), 10, 0)
+		must(err, "parsing USERID", nil)
+		user, err := api.UserByID(id)
+		must(err, "loading user", nil)
+		apply(user)
+		must(api.UpdateUser(user), "updating user", nil)
+	case "delete":
+		id, err := strconv.ParseUint(fset.Arg(0), 10, 0)
+		must(err, "parsing USERID", nil)
+		if prompt(false, "Delete user") { must(api.DeleteUser(id), "deleting user", nil) }
+	case "reset":
+		id, err := strconv.ParseUint(fset.Arg(0), 10, 0)
+		must(err, "parsing USERID", nil)
+		must(api.ResetPassword(id), "resetting password", nil)
+	case "import":
+		if fset.Arg(0) == "" { exitMessage(userUsage) }
+		importUsers(api, fset.Arg(0))
+	default:
+		exitMessage(userUsage)
+	}
+}
+
+// importUsers creates a user for every row of a CSV file with a header of
+// name,email,password,kindle_email,roles,locale,default_language,allowed_tags,denied_tags.
+// Only name and password are required, lists are separated by ';'.
+func importUsers(api *calibre.API, path string) {
+	file, err := os.Open(path)
+	must(err, "opening CSV", nil)
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	header, err := r.Read()
+	must(err, "reading CSV header", nil)
+	columns := map[string]int{}
+	for i, name := range header { columns[strings.TrimSpace(strings.ToLower(name))] = i }
+	if _, ok := columns["name"]; !ok { exitMessage("CSV has no name column") }
+
+	var created, failed int
+	for line := 2; ; line++ {
+		row, err := r.Read()
+		if err == io.EOF { break }
+		must(err, "reading CSV", nil)
+
+		get := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(row) { return "" }
+			return strings.TrimSpace(row[i])
+		}
+
+		role, err := calibre.ParseRole(strings.ReplaceAll(get("roles"), ";", ","))
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "line %d: %s\n", line, err)
+			continue
+		}
+
+		user, err := api.CreateUser(&calibre.User{
+			Name: get("name"),
+			Email: get("email"),
+			Password: get("password"),
+			KindleEmail: get("kindle_email"),
+			Role: role,
+			Locale: get("locale"),
+			DefaultLanguage: get("default_language"),
+			AllowedTags: splitList(get("allowed_tags")),
+			DeniedTags: splitList(get("denied_tags")),
+		})
+		if err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "line %d: %s: %s\n", line, get("name"), err)
+			continue
+		}
+		created++
+		fmt.Printf("Created user: %s (%d)\n", user.Name, user.ID())
+	}
+
+	fmt.Printf("Created %d, failed %d\n", created, failed)
+	if failed > 0 { os.Exit(1) }
+}
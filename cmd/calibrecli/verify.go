@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/yrhki/gocalibre/calibre-web"
+)
+
+// verifyManifest downloads every format recorded in an import manifest
+// and compares it with the checksum taken when it was uploaded
+func verifyManifest(api *calibre.API, args []string) {
+	fset := flag.NewFlagSet("verify", flag.ExitOnError)
+	fset.Parse(args)
+	if fset.Arg(0) == "" { exitMessage("usage: clibrecli verify <MANIFEST>") }
+
+	m, err := loadManifest(fset.Arg(0))
+	must(err, "loading manifest", nil)
+
+	keys := make([]string, 0, len(m.Entries))
+	for key := range m.Entries { keys = append(keys, key) }
+	sort.Strings(keys)
+
+	var ok, failed int
+	for _, key := range keys {
+		e := m.Entries[key]
+		if e.BookID == 0 { continue }
+
+		exts := make([]string, 0, len(e.Checksums))
+		for ext := range e.Checksums { exts = append(exts, ext) }
+		sort.Strings(exts)
+
+		for _, ext := range exts {
+			err := verifyFormat(api, e.BookID, ext, e.Checksums[ext])
+			if err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "FAIL %s (%d) %s: %s\n", key, e.BookID, ext, err)
+			} else {
+				ok++
+				fmt.Printf("OK   %s (%d) %s\n", key, e.BookID, ext)
+			}
+		}
+	}
+
+	fmt.Printf("Verified %d, failed %d\n", ok, failed)
+	if failed > 0 { os.Exit(1) }
+}
+
+func verifyFormat(api *calibre.API, id uint64, ext, sum string) error {
+	format, ok := calibre.FormatFromExt(ext)
+	if !ok { return errors.New("unknown format") }
+	expected, err := hex.DecodeString(sum)
+	if err != nil { return err }
+	_, err = api.DownloadFormatTo(context.Background(), id, format, ioutil.Discard, expected)
+	return err
+}